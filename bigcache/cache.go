@@ -18,6 +18,7 @@ type Cache interface {
 type BigCache struct {
 	cache   *bigcache.BigCache
 	metrics metrics.BigCacheMetrics
+	cancel  context.CancelFunc
 }
 
 func NewInMemCache(configs config.BigCacheConfig) (*BigCache, error) {
@@ -30,19 +31,28 @@ func NewInMemCache(configs config.BigCacheConfig) (*BigCache, error) {
 	config.MaxEntrySize = configs.MaxEntrySize         // in bytes
 	config.HardMaxCacheSize = configs.HardMaxCacheSize // in MB
 
-	cache, err := bigcache.New(context.Background(), config)
+	ctx, cancel := context.WithCancel(context.Background())
+	cache, err := bigcache.New(ctx, config)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
-	go metrics.CollectStatistics(cache, cacheMetrics)
+	go metrics.CollectStatistics(ctx, cache, cacheMetrics)
 
 	return &BigCache{
 		cache:   cache,
 		metrics: cacheMetrics,
+		cancel:  cancel,
 	}, nil
 }
 
+// Close stops the stats collector and the cleanup goroutine of the cache.
+func (c *BigCache) Close() error {
+	c.cancel()
+	return c.cache.Close()
+}
+
 func (c *BigCache) GetValue(key string) (resp []byte, found bool, err error) {
 	resp, err = c.cache.Get(key)
 	if err != nil {
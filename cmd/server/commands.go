@@ -0,0 +1,86 @@
+package main
+
+import (
+	"backend/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+)
+
+// cmdValidateConfig loads and validates the configuration without starting the server,
+// so that CI can check config files before they are deployed.
+const cmdValidateConfig = "validate-config"
+
+// cmdConfig groups tooling around the configuration files, "config schema" prints
+// the JSON Schema editors and deployment tooling validate the YAML files against.
+const (
+	cmdConfig       = "config"
+	cmdConfigSchema = "schema"
+)
+
+func validateConfig(loader *config.Loader) int {
+	cfg, err := config.InitConfigurations(loader)
+	if err == nil {
+		err = newRouteRegistry(context.Background(), func() *config.Configurations { return &cfg }, nil).Check(cfg.Routes)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitInvalidConfig
+	}
+	fmt.Printf("configuration is valid, loaded from %v\n", loader.Files())
+	return exitOK
+}
+
+func configCommand(args []string, opts config.Options) int {
+	if len(args) != 1 || args[0] != cmdConfigSchema {
+		fmt.Fprintf(os.Stderr, "usage: %s %s %s [--config path] [--environment env]\n", os.Args[0], cmdConfig, cmdConfigSchema)
+		return exitServerFailure
+	}
+	return printSchema(os.Stdout, opts)
+}
+
+// printSchema writes the JSON Schema of the configuration, defaults are taken from the
+// config layers selected by opts.
+func printSchema(w io.Writer, opts config.Options) int {
+	loader := config.NewLoader(opts)
+	defaults, err := loader.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitInvalidConfig
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(config.Schema(&defaults, loader.SecretKeys())); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitServerFailure
+	}
+	return exitOK
+}
+
+// printUsage lists the commands and the full configuration tree. Defaults are taken from
+// the config files and environment variables that would be used without flags.
+func printUsage(w io.Writer, flags *pflag.FlagSet, opts config.Options) {
+	fmt.Fprintf(w, "Usage: %s [command] [flags]\n\n", os.Args[0])
+	fmt.Fprintf(w, "Commands:\n")
+	fmt.Fprintf(w, "  %s\tload and validate the configuration, then exit\n", cmdValidateConfig)
+	fmt.Fprintf(w, "  %s %s\tprint the JSON Schema of the config files\n\n", cmdConfig, cmdConfigSchema)
+	fmt.Fprintf(w, "Flags:\n")
+	for _, name := range []string{"config", "environment"} {
+		f := flags.Lookup(name)
+		fmt.Fprintf(w, "  --%s\t%s\n", f.Name, f.Usage)
+	}
+
+	fmt.Fprintf(w, "\nConfiguration, every value can be set with the flag or environment variable shown:\n\n")
+	loader := config.NewLoader(opts)
+	defaults, err := loader.Load()
+	if err != nil {
+		fmt.Fprintf(w, "(defaults unavailable: %v)\n\n", err)
+		config.PrintUsage(w, nil, nil)
+		return
+	}
+	config.PrintUsage(w, &defaults, loader.SecretKeys())
+}
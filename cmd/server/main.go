@@ -1,50 +1,252 @@
 package main
 
 import (
+	"backend/bigcache"
 	"backend/config"
+	"backend/featureflags"
 	"backend/handler"
 	"backend/httpserver"
-	"backend/logger"
+	loggerpkg "backend/logger"
 	"backend/metrics"
+	"backend/tracing"
 	"context"
+	"errors"
 	"fmt"
 	golog "log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	metricCollector "github.com/afex/hystrix-go/hystrix/metric_collector"
 
-	"github.com/sanity-io/litter"
+	"github.com/spf13/pflag"
 	"go.uber.org/zap"
 )
 
+// Process exit codes, so that the orchestrator can tell a clean stop from a failure.
+const (
+	exitOK            = 0
+	exitServerFailure = 1
+	exitDrainTimeout  = 2
+	exitInvalidConfig = 3
+)
+
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	command := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	flags := pflag.NewFlagSet(os.Args[0]+" "+command, pflag.ContinueOnError)
+	configPath := flags.String("config", "", "config directory or defaults file, overrides $"+config.EnvConfigPath)
+	environment := flags.String("environment", "", "environment whose <environment>.yaml is layered over the defaults, overrides $"+config.EnvEnvironment)
+	// Usage depends on --config and --environment, so help is only printed after all flags
+	// were parsed rather than by pflag when it reaches --help.
+	help := flags.BoolP("help", "h", false, "print this help")
+	config.RegisterFlags(flags)
+	flags.Usage = func() {}
+	if err := flags.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "%v, see --help\n", err)
+		return exitServerFailure
+	}
+	if *help {
+		printUsage(os.Stdout, flags, config.Options{Path: *configPath, Environment: *environment})
+		return exitOK
+	}
+
+	loader := config.NewLoader(config.Options{
+		Path:        *configPath,
+		Environment: *environment,
+		Flags:       flags,
+	})
+
+	switch command {
+	case "":
+		return serve(loader)
+	case cmdValidateConfig:
+		return validateConfig(loader)
+	case cmdConfig:
+		return configCommand(flags.Args(), config.Options{Path: *configPath, Environment: *environment})
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, available commands: %s, %s\n", command, cmdValidateConfig, cmdConfig+" "+cmdConfigSchema)
+		return exitServerFailure
+	}
+}
+
+func serve(loader *config.Loader) int {
 	ctx := context.Background()
-	cfg := config.InitConfigurations()
-	golog.Print(litter.Sdump(config.Configuration))
+	cfg, err := config.InitConfigurations(loader)
+	if err != nil {
+		golog.Printf("error loading configuration - %v", err)
+		return exitInvalidConfig
+	}
+	golog.Printf("configuration %s loaded from %v, value sources:\n%s", config.Hash(&cfg, loader.SecretKeys()), loader.Files(), loader.Sources())
 
-	logger, err := logger.ConfigureLogging(&cfg.LogConfig)
+	logger, err := loggerpkg.ConfigureLogging(&cfg.LogConfig)
 	if err != nil {
 		golog.Fatalf("error initializing logger - %v", err)
 	}
-	logger.Info("Starting Application...", zap.String("asd", "asd"))
+	defer logger.Sync()
+	logger.Info("Starting Application...")
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing, cfg.AppName, cfg.Environment)
+	if err != nil {
+		logger.Error("error setting up tracing", zap.Error(err))
+		return exitServerFailure
+	}
+	defer func() {
+		// Flush buffered spans, the drain deadline of the servers does not apply here.
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			logger.Error("error flushing spans", zap.Error(err))
+		}
+	}()
 
 	registerHystrixMetrics()
+	config.ConfigureHystrixCommands(cfg.Hystrix)
+	featureflags.SetFlags(cfg.FeatureFlags)
 
-	// _, err := bigcache.NewInMemCache(config.Configuration.BigCache)
+	cache, err := bigcache.NewInMemCache(cfg.BigCache)
 	if err != nil {
-		// logger.Fatalw(ctx, "Error creating big cache", zap.Error(err))
+		logger.Error("Error creating big cache", zap.Error(err))
+		return exitServerFailure
 	}
-	router := httpserver.NewRouter()
-	updateHttpRouter(ctx, router)
+	defer cache.Close()
+
+	watcher := config.NewWatcher(loader, cfg)
+	watchConfiguration(watcher, logger)
 
-	hs := httpserver.NewServer(&config.HttpServer{}, router)
+	router := httpserver.NewRouter(httpserver.RouterOptions{
+		Logger:       logger,
+		ExposePanics: func() bool { return watcher.Current().HttpServer.ExposePanics },
+		AccessLog:    func() *config.AccessLog { return &watcher.Current().AccessLog },
+		CtxKeys:      func() []string { return watcher.Current().LogConfig.CtxKeys },
+		ConcurrencyLimit: func() *config.ConcurrencyLimit {
+			return &watcher.Current().ConcurrencyLimit
+		},
+	})
+	if err := updateHttpRouter(ctx, router, newRouteRegistry(ctx, watcher.Current, cache), cfg.Routes); err != nil {
+		logger.Error("error wiring routes", zap.Error(err))
+		return exitInvalidConfig
+	}
+	hs := httpserver.NewServer(cfg.HttpServer, router, logger)
+
+	adminRouter := httpserver.NewAdminRouter(logger)
+	handler.NewHealthChecker(adminRouter, hs.Readiness())
+	handler.NewHystrixSettingsHandler(adminRouter)
+	handler.NewConfigHandler(adminRouter, watcher)
+	admin := httpserver.NewServer(cfg.AdminServer, adminRouter, logger)
+
+	serverErr := make(chan error, 2)
+	for _, srv := range []*httpserver.Server{hs, admin} {
+		go func(srv *httpserver.Server) {
+			serverErr <- srv.Start()
+		}(srv)
+	}
+
+	select {
+	case err := <-serverErr:
+		logger.Error("http server failed", zap.Error(err))
+		shutdown(ctx, logger, admin, hs)
+		return exitServerFailure
+	case sig := <-waitForTermination():
+		logger.Info("User initiated shutdown::", zap.String("signal", sig.String()))
+	}
 
-	go hs.Start()
-	waitForTermination()
-	fmt.Println(ctx, "User initiated shutdown::")
+	// The public listener is drained first, admin keeps serving readiness and metrics meanwhile.
+	code := shutdown(ctx, logger, hs, admin)
+	for i := 0; i < 2; i++ {
+		if err := <-serverErr; err != nil {
+			logger.Error("http server failed", zap.Error(err))
+			code = exitServerFailure
+		}
+	}
+	if code == exitOK {
+		logger.Info("Shutdown complete")
+	}
+	return code
+}
+
+// shutdown stops the given servers in order and maps the outcome to an exit code.
+func shutdown(ctx context.Context, logger *zap.Logger, servers ...*httpserver.Server) int {
+	code := exitOK
+	for _, srv := range servers {
+		err := srv.Shutdown(ctx)
+		if err == nil {
+			continue
+		}
+		logger.Error("http server did not drain in time", zap.Error(err))
+		// Keep the most severe outcome, a failure is never downgraded to a drain timeout.
+		if !errors.Is(err, context.DeadlineExceeded) {
+			code = exitServerFailure
+		} else if code == exitOK {
+			code = exitDrainTimeout
+		}
+	}
+	return code
+}
+
+// watchConfiguration subscribes the reloadable components and starts watching the config files.
+func watchConfiguration(watcher *config.Watcher, logger *zap.Logger) {
+	config.Subscribe(watcher, func(c *config.Configurations) config.Log { return c.LogConfig },
+		func(old, new config.Log) {
+			if err := loggerpkg.SetLevel(&new); err != nil {
+				logger.Error("failed to change log level", zap.Error(err))
+				return
+			}
+			logger.Info("log level changed", zap.String("old", old.Level), zap.String("new", new.Level))
+		})
+	config.Subscribe(watcher, func(c *config.Configurations) config.Cors { return c.Cors },
+		func(_, new config.Cors) {
+			logger.Info("cors settings changed", zap.Strings("origins", new.Origins))
+		})
+	config.Subscribe(watcher, func(c *config.Configurations) map[string]*config.RateLimit { return c.RateLimits },
+		func(_, new map[string]*config.RateLimit) {
+			logger.Info("rate limits changed", zap.Int("policies", len(new)))
+		})
+	config.Subscribe(watcher, func(c *config.Configurations) config.ConcurrencyLimit { return c.ConcurrencyLimit },
+		func(_, new config.ConcurrencyLimit) {
+			logger.Info("concurrency limit changed", zap.Bool("enabled", new.Enabled),
+				zap.Int("minLimit", new.MinLimit), zap.Int("maxLimit", new.MaxLimit))
+		})
+	config.Subscribe(watcher, func(c *config.Configurations) config.Hystrix { return c.Hystrix },
+		func(_, new config.Hystrix) {
+			config.ConfigureHystrixCommands(new)
+			logger.Info("hystrix commands reconfigured", zap.Int("commands", len(new.Commands)))
+		})
+	config.Subscribe(watcher, func(c *config.Configurations) map[string]config.FeatureFlag { return c.FeatureFlags },
+		func(_, new map[string]config.FeatureFlag) {
+			featureflags.SetFlags(new)
+			logger.Info("feature flags changed", zap.Int("flags", len(new)))
+		})
+	config.Subscribe(watcher, func(c *config.Configurations) config.BigCacheConfig { return c.BigCache },
+		func(_, _ config.BigCacheConfig) {
+			logger.Warn("BIG_CACHE changes are applied on the next restart")
+		})
+	config.Subscribe(watcher, func(c *config.Configurations) config.Tracing { return c.Tracing },
+		func(_, _ config.Tracing) {
+			logger.Warn("TRACING changes are applied on the next restart")
+		})
+	config.Subscribe(watcher, func(c *config.Configurations) map[string]config.Route { return c.Routes },
+		func(_, _ map[string]config.Route) {
+			logger.Warn("ROUTES changes other than CACHE settings are applied on the next restart")
+		})
+
+	watcher.Watch(func(err error) {
+		if err != nil {
+			logger.Error("configuration reload rejected", zap.Error(err))
+			return
+		}
+		logger.Info("configuration reloaded")
+	})
 }
 
 func registerHystrixMetrics() {
@@ -54,9 +256,64 @@ func registerHystrixMetrics() {
 	metricCollector.Registry.Register(collector.NewPrometheusCollector)
 }
 
-func updateHttpRouter(ctx context.Context, router httpserver.Router) {
+// newRouteRegistry registers every handler and middleware the ROUTES config section can refer to.
+// Middlewares read their settings from current on every request, so that they follow reloads.
+// cache is the application cache shared by rate limits and cached responses, nil when routes
+// are only checked.
+func newRouteRegistry(ctx context.Context, current func() *config.Configurations, cache bigcache.Cache) *httpserver.RouteRegistry {
+	rateLimitStores := map[string]httpserver.RateLimitStore{
+		config.RateLimitStoreMemory:   httpserver.NewMemoryRateLimitStore(),
+		config.RateLimitStoreBigCache: httpserver.NewCacheRateLimitStore(cache),
+	}
+	registry := httpserver.NewRouteRegistry()
+	registry.Middleware("cors", func(_ string, route config.Route) (httpserver.Middleware, error) {
+		if current().CorsPolicy(route.CorsPolicy) == nil {
+			return nil, fmt.Errorf("unknown CORS policy %q", route.CorsPolicy)
+		}
+		return httpserver.DynamicCorsMiddleware(func() *config.Cors {
+			return current().CorsPolicy(route.CorsPolicy)
+		}), nil
+	})
+	registry.Middleware("rate_limit", func(_ string, route config.Route) (httpserver.Middleware, error) {
+		if route.RateLimit == "" {
+			return nil, fmt.Errorf("RATE_LIMIT is not set")
+		}
+		if current().RateLimitPolicy(route.RateLimit) == nil {
+			return nil, fmt.Errorf("unknown rate limit %q", route.RateLimit)
+		}
+		return httpserver.RateLimitMiddleware(route.Path, func() *config.RateLimit {
+			return current().RateLimitPolicy(route.RateLimit)
+		}, rateLimitStores, func() *config.AccessLog {
+			return &current().AccessLog
+		}), nil
+	})
+	registry.Middleware("compress", func(_ string, route config.Route) (httpserver.Middleware, error) {
+		return httpserver.CompressionMiddleware(route.Path, func() *config.Compression {
+			return &current().Compression
+		}), nil
+	})
+	registry.Middleware("cache", func(name string, route config.Route) (httpserver.Middleware, error) {
+		if route.Cache == nil {
+			return nil, fmt.Errorf("CACHE is not set")
+		}
+		return httpserver.ResponseCacheMiddleware(route.Path, func() *config.RouteCache {
+			return current().Routes[name].Cache
+		}, cache, func() *config.ResponseCache {
+			return &current().ResponseCache
+		}), nil
+	})
+	registry.StaticMiddleware("request_id", httpserver.DynamicRequestIdMiddleware(func() *config.RequestID {
+		return &current().RequestID
+	}))
 
-	handler.NewLocationAPIHandler(ctx, router)
+	handler.NewLocationAPIHandler(ctx, registry)
+	return registry
+}
+
+func updateHttpRouter(ctx context.Context, router httpserver.Router, registry *httpserver.RouteRegistry, routes map[string]config.Route) error {
+	if err := registry.Mount(router, routes); err != nil {
+		return err
+	}
 
 	//For SLT mode lets add a handler which can gracefully terminate out server.
 	if false {
@@ -73,10 +330,11 @@ func updateHttpRouter(ctx context.Context, router httpserver.Router) {
 			Instrument: false,
 		})
 	}
+	return nil
 }
 
-func waitForTermination() {
+func waitForTermination() <-chan os.Signal {
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, os.Interrupt /*os.Kill,*/, syscall.SIGTERM)
-	<-ch
+	return ch
 }
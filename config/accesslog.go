@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// AccessLog configures the access log of the public listener. Client and server errors and
+// requests slower than SlowThreshold are always logged, other requests are sampled.
+type AccessLog struct {
+	Enabled bool `mapstructure:"ENABLED" desc:"Log requests, routes can opt out with ACCESS_LOG: false"`
+	// SuccessSampleRatio is the share of requests below status 400 that are logged.
+	SuccessSampleRatio float64       `mapstructure:"SUCCESS_SAMPLE_RATIO" desc:"Share of successful requests that are logged, between 0 and 1"`
+	SlowThreshold      time.Duration `mapstructure:"SLOW_THRESHOLD" desc:"Requests taking longer are always logged, 0 disables"`
+	// TrustedProxies are the IPs and CIDRs whose X-Forwarded-For header is trusted for the client IP.
+	TrustedProxies []string `mapstructure:"TRUSTED_PROXIES" desc:"Proxies, as IPs or CIDRs, whose X-Forwarded-For is trusted"`
+}
+
+// ParsedTrustedProxies parses TrustedProxies, single IPs become single address prefixes.
+func (c *AccessLog) ParsedTrustedProxies() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedProxies))
+	for _, p := range c.TrustedProxies {
+		p = strings.TrimSpace(p)
+		if strings.Contains(p, "/") {
+			prefix, err := netip.ParsePrefix(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", p)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP %q", p)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+func (c *AccessLog) validate(v *validator, path string) {
+	if c.SuccessSampleRatio < 0 || c.SuccessSampleRatio > 1 {
+		v.addf(joinPath(path, "SUCCESS_SAMPLE_RATIO"), "%v is out of range 0-1", c.SuccessSampleRatio)
+	}
+	if c.SlowThreshold < 0 {
+		v.addf(joinPath(path, "SLOW_THRESHOLD"), "must not be negative, got %v", c.SlowThreshold)
+	}
+	if _, err := c.ParsedTrustedProxies(); err != nil {
+		v.addf(joinPath(path, "TRUSTED_PROXIES"), "%v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Content codings supported by the compress middleware, in the default order of preference.
+const (
+	EncodingBrotli = "br"
+	EncodingZstd   = "zstd"
+	EncodingGzip   = "gzip"
+)
+
+var (
+	CompressionEncodings = []string{EncodingBrotli, EncodingZstd, EncodingGzip}
+	CompressionLevels    = []string{"fastest", "default", "best"}
+)
+
+// Compression configures the compress middleware. Responses of at least MIN_SIZE bytes are
+// compressed with the encoding of ENCODINGS the client accepts with the highest quality,
+// ties go to the one listed first.
+type Compression struct {
+	Enabled   bool     `mapstructure:"ENABLED" desc:"Compress responses of routes using the compress middleware"`
+	MinSize   int      `mapstructure:"MIN_SIZE" desc:"Smallest response in bytes that is compressed"`
+	Encodings []string `mapstructure:"ENCODINGS" enum:"br,zstd,gzip" desc:"Offered encodings in order of preference, empty offers all"`
+	Level     string   `mapstructure:"LEVEL" enum:"fastest,default,best" desc:"Compression level, empty is default"`
+	// SkipContentTypes are not compressed any further. Entries ending in / match a whole
+	// top-level type such as video/.
+	SkipContentTypes []string `mapstructure:"SKIP_CONTENT_TYPES" desc:"Already compressed content types, entries ending in / match the whole type"`
+	// DecompressRequests accepts request bodies in one of ENCODINGS and hands them to the
+	// handler decoded. Bodies decoding to more than MAX_REQUEST_SIZE bytes are cut off.
+	DecompressRequests bool `mapstructure:"DECOMPRESS_REQUESTS" desc:"Decode request bodies sent with Content-Encoding"`
+	MaxRequestSize     int  `mapstructure:"MAX_REQUEST_SIZE" desc:"Largest decoded request body in bytes, 0 is unlimited"`
+}
+
+// ParsedEncodings returns Encodings lower-cased with the default filled in.
+func (c *Compression) ParsedEncodings() []string {
+	if len(c.Encodings) == 0 {
+		return CompressionEncodings
+	}
+	encodings := make([]string, 0, len(c.Encodings))
+	for _, e := range c.Encodings {
+		encodings = append(encodings, strings.ToLower(strings.TrimSpace(e)))
+	}
+	return encodings
+}
+
+// SkipsContentType reports whether responses of contentType, a Content-Type header value,
+// are left uncompressed.
+func (c *Compression) SkipsContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, skip := range c.SkipContentTypes {
+		skip = strings.ToLower(strings.TrimSpace(skip))
+		if mediaType == skip || strings.HasSuffix(skip, "/") && strings.HasPrefix(mediaType, skip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Compression) validate(v *validator, path string) {
+	if c.MinSize < 0 {
+		v.addf(joinPath(path, "MIN_SIZE"), "must not be negative, got %d", c.MinSize)
+	}
+	for i, e := range c.ParsedEncodings() {
+		if !slices.Contains(CompressionEncodings, e) {
+			v.addf(fmt.Sprintf("%s[%d]", joinPath(path, "ENCODINGS"), i), "unknown encoding %q, expected one of %s", e, strings.Join(CompressionEncodings, ", "))
+		}
+	}
+	if c.Level != "" && !slices.Contains(CompressionLevels, c.Level) {
+		v.addf(joinPath(path, "LEVEL"), "unknown level %q, expected one of %s", c.Level, strings.Join(CompressionLevels, ", "))
+	}
+	if c.MaxRequestSize < 0 {
+		v.addf(joinPath(path, "MAX_REQUEST_SIZE"), "must not be negative, got %d", c.MaxRequestSize)
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import "time"
+
+const DefaultPriorityHeader = "X-Priority"
+
+// ConcurrencyLimit bounds the requests served at the same time. The limit starts at
+// INITIAL_LIMIT and adapts between MIN_LIMIT and MAX_LIMIT: requests slower than
+// LATENCY_TARGET shrink it by BACKOFF_RATIO, at most once per LATENCY_TARGET, and fast
+// requests grow it by about one per limit requests while it is in use.
+//
+// Requests beyond the limit are shed with a 503. PRIORITY_RESERVE of the limit is kept for
+// requests whose PRIORITY_HEADER is "high".
+type ConcurrencyLimit struct {
+	Enabled         bool          `mapstructure:"ENABLED" desc:"Limit concurrent requests"`
+	InitialLimit    int           `mapstructure:"INITIAL_LIMIT" desc:"Limit before any latency was observed"`
+	MinLimit        int           `mapstructure:"MIN_LIMIT" desc:"Lowest the limit shrinks to"`
+	MaxLimit        int           `mapstructure:"MAX_LIMIT" desc:"Highest the limit grows to"`
+	LatencyTarget   time.Duration `mapstructure:"LATENCY_TARGET" desc:"Requests slower than this shrink the limit"`
+	BackoffRatio    float64       `mapstructure:"BACKOFF_RATIO" desc:"Factor the limit is multiplied with on slow requests, between 0 and 1"`
+	PriorityHeader  string        `mapstructure:"PRIORITY_HEADER" desc:"Header marking priority requests with the value high, empty is X-Priority"`
+	PriorityReserve float64       `mapstructure:"PRIORITY_RESERVE" desc:"Share of the limit only priority requests may use, between 0 and 1"`
+}
+
+// ParsedPriorityHeader returns PriorityHeader with the default filled in.
+func (c *ConcurrencyLimit) ParsedPriorityHeader() string {
+	if c.PriorityHeader == "" {
+		return DefaultPriorityHeader
+	}
+	return c.PriorityHeader
+}
+
+func (c *ConcurrencyLimit) validate(v *validator, path string) {
+	if !c.Enabled {
+		return
+	}
+	if c.MinLimit < 1 {
+		v.addf(joinPath(path, "MIN_LIMIT"), "must be positive, got %d", c.MinLimit)
+	}
+	if c.MaxLimit < c.MinLimit {
+		v.addf(joinPath(path, "MAX_LIMIT"), "must not be below MIN_LIMIT %d, got %d", c.MinLimit, c.MaxLimit)
+	}
+	if c.InitialLimit < c.MinLimit || c.InitialLimit > c.MaxLimit {
+		v.addf(joinPath(path, "INITIAL_LIMIT"), "%d is out of range %d-%d", c.InitialLimit, c.MinLimit, c.MaxLimit)
+	}
+	if c.LatencyTarget <= 0 {
+		v.addf(joinPath(path, "LATENCY_TARGET"), "must be positive, got %v", c.LatencyTarget)
+	}
+	if c.BackoffRatio <= 0 || c.BackoffRatio >= 1 {
+		v.addf(joinPath(path, "BACKOFF_RATIO"), "%v is out of range, it has to be above 0 and below 1", c.BackoffRatio)
+	}
+	if c.PriorityReserve < 0 || c.PriorityReserve >= 1 {
+		v.addf(joinPath(path, "PRIORITY_RESERVE"), "%v is out of range, it has to be at least 0 and below 1", c.PriorityReserve)
+	}
+}
@@ -2,77 +2,171 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"time"
-
-	"github.com/spf13/viper"
 )
 
 type HttpServer struct {
-	Port         int
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-	IdleTimeout  time.Duration
+	// Host is the address to bind to. Empty binds on all interfaces.
+	Host              string        `desc:"Address to bind to, empty binds on all interfaces"`
+	Port              int           `desc:"Port to listen on"`
+	ReadTimeout       time.Duration `desc:"Maximum duration for reading the entire request, including the body"`
+	ReadHeaderTimeout time.Duration `desc:"Maximum duration for reading the request headers"`
+	WriteTimeout      time.Duration `desc:"Maximum duration before timing out writes of the response"`
+	IdleTimeout       time.Duration `desc:"Maximum time to wait for the next request on a keep-alive connection"`
+	// MaxHeaderBytes caps the size of request headers. 0 uses net/http's default of 1MB.
+	MaxHeaderBytes int `desc:"Maximum size of request headers in bytes, 0 uses the default of 1MB"`
+	// DisableKeepAlives turns off HTTP keep-alives, every request gets a fresh connection.
+	DisableKeepAlives bool `desc:"Turn off HTTP keep-alives"`
+	// TCPKeepAlive is the keep-alive period of accepted TCP connections.
+	// 0 uses the Go default and a negative value disables TCP keep-alives.
+	TCPKeepAlive time.Duration `desc:"Keep-alive period of accepted TCP connections, negative disables them"`
+	// ShutdownTimeout bounds how long in-flight requests are drained on shutdown.
+	ShutdownTimeout time.Duration `desc:"Maximum time to drain in-flight requests on shutdown"`
+	// PreStopDelay is the time we keep serving after readiness starts failing,
+	// so that load balancers can stop routing new requests to us.
+	PreStopDelay time.Duration `desc:"Time to keep serving after readiness starts failing on shutdown"`
+	TLS          TLS           `desc:"HTTPS and client certificate settings"`
+	// ExposePanics puts the panic value and stack into 500 responses, for debugging only.
+	ExposePanics bool `desc:"Include the stack trace of a recovered panic in the 500 response, never in production"`
 }
 
 func (c *HttpServer) String() string {
-	return fmt.Sprintf("Port - %d, readTimeout: %v, WriteTimeout: %v, Idletimeout: %v",
-		c.Port, c.ReadTimeout, c.WriteTimeout, c.IdleTimeout)
+	if c == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("Addr - %s, readTimeout: %v, readHeaderTimeout: %v, WriteTimeout: %v, Idletimeout: %v, "+
+		"MaxHeaderBytes: %d, DisableKeepAlives: %v, TCPKeepAlive: %v, ShutdownTimeout: %v, PreStopDelay: %v, TLS: %v",
+		c.Addr(), c.ReadTimeout, c.ReadHeaderTimeout, c.WriteTimeout, c.IdleTimeout,
+		c.MaxHeaderBytes, c.DisableKeepAlives, c.TCPKeepAlive, c.ShutdownTimeout, c.PreStopDelay, c.TLS.Enabled)
 }
 
-type BigCacheConfig struct {
-	TTL              int  `mapstructure:"TTL_SECS"`
-	Flag             bool `mapstructure:"FLAG"`
-	Shards           int  `mapstructure:"SHARDS"`
-	MaxEntrySize     int  `mapstructure:"MAX_ENTRY_SIZE"`
-	StatsEnabled     bool `mapstructure:"STATS_ENABLED"`
-	HardMaxCacheSize int  `mapstructure:"HARD_MAX_CACHE_SIZE"`
+// Addr returns the host:port the server listens on.
+func (c *HttpServer) Addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
 }
 
-type Cors struct {
-	Origins []string `mapstructure:"ORIGINS"`
-	Methods []string `mapstructure:"METHODS"`
-	Headers []string `mapstructure:"HEADERS"`
+// Validate checks that the server can be started with this configuration.
+// Zero timeouts are rejected as they leave the server open to slow clients.
+func (c *HttpServer) Validate() error {
+	v := &validator{}
+	c.validate(v, "")
+	return v.err()
+}
+
+func (c *HttpServer) validate(v *validator, path string) {
+	if c == nil {
+		v.addf(path, "http server config is missing")
+		return
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		v.addf(joinPath(path, "port"), "%d is out of range 1-65535", c.Port)
+	}
+	if c.Host != "" && net.ParseIP(c.Host) == nil && !validHostname(c.Host) {
+		v.addf(joinPath(path, "host"), "%q is not a valid IP address or hostname", c.Host)
+	}
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"readTimeout", c.ReadTimeout},
+		{"readHeaderTimeout", c.ReadHeaderTimeout},
+		{"writeTimeout", c.WriteTimeout},
+		{"idleTimeout", c.IdleTimeout},
+	}
+	for _, t := range timeouts {
+		if t.value <= 0 {
+			v.addf(joinPath(path, t.name), "must be positive, got %v", t.value)
+		}
+	}
+	if c.ReadHeaderTimeout > c.ReadTimeout && c.ReadTimeout > 0 {
+		v.addf(joinPath(path, "readHeaderTimeout"), "%v must not exceed readTimeout %v", c.ReadHeaderTimeout, c.ReadTimeout)
+	}
+	if c.MaxHeaderBytes < 0 {
+		v.addf(joinPath(path, "maxHeaderBytes"), "must not be negative, got %d", c.MaxHeaderBytes)
+	}
+	if c.ShutdownTimeout < 0 {
+		v.addf(joinPath(path, "shutdownTimeout"), "must not be negative, got %v", c.ShutdownTimeout)
+	}
+	if c.PreStopDelay < 0 {
+		v.addf(joinPath(path, "preStopDelay"), "must not be negative, got %v", c.PreStopDelay)
+	}
+	c.TLS.validate(v, joinPath(path, "tls"))
+}
+
+func validHostname(host string) bool {
+	if len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type BigCacheConfig struct {
+	TTL              int  `mapstructure:"TTL_SECS" desc:"Time to live of cache entries in seconds"`
+	Flag             bool `mapstructure:"FLAG" desc:"Enables the cache"`
+	Shards           int  `mapstructure:"SHARDS" desc:"Number of cache shards, must be a power of two"`
+	MaxEntrySize     int  `mapstructure:"MAX_ENTRY_SIZE" desc:"Expected maximum entry size in bytes, used for initial allocation"`
+	StatsEnabled     bool `mapstructure:"STATS_ENABLED" desc:"Collect hit and miss statistics"`
+	HardMaxCacheSize int  `mapstructure:"HARD_MAX_CACHE_SIZE" desc:"Maximum cache size in MB, 0 is unlimited"`
 }
 
 type Log struct {
-	Level                      string   `mapstructure:"LEVEL"`
-	Env                        string   `mapstructure:"ENV"`
-	GoCommonLoggingEnable      bool     `mapstructure:"GO_COMMON_LOGGING_ENABLE"`
-	CtxKeys                    []string `mapstructure:"CTX_KEYS"`
-	IsDebugLevelLoggingEnabled bool     `mapstructure:"DEBUG_LOGGING_ENABLED"`
+	Level                      string   `mapstructure:"LEVEL" enum:"debug,info,warn,error,dpanic,panic,fatal" desc:"Minimum log level"`
+	Env                        string   `mapstructure:"ENV" desc:"Environment name added to log entries"`
+	GoCommonLoggingEnable      bool     `mapstructure:"GO_COMMON_LOGGING_ENABLE" desc:"Enable logging of the go-common libraries"`
+	CtxKeys                    []string `mapstructure:"CTX_KEYS" desc:"Request context keys added to log entries"`
+	IsDebugLevelLoggingEnabled bool     `mapstructure:"DEBUG_LOGGING_ENABLED" desc:"Enable debug logging"`
 }
 
 type Configurations struct {
-	Environment string
-	AppName     string         `mapstructure:"APP_NAME"`
-	LogConfig   Log            `mapstructure:"LOG"`
-	BigCache    BigCacheConfig `mapstructure:"BIG_CACHE"`
-	HttpServer  *HttpServer    `json:"httpServer"`
+	Environment   string                 `mapstructure:"ENVIRONMENT" desc:"Deployment environment, selects <environment>.yaml"`
+	AppName       string                 `mapstructure:"APP_NAME" desc:"Application name"`
+	LogConfig     Log                    `mapstructure:"LOG" desc:"Logging"`
+	BigCache      BigCacheConfig         `mapstructure:"BIG_CACHE" desc:"In-memory cache"`
+	Cors          Cors                   `mapstructure:"CORS" desc:"Default cross-origin resource sharing policy"`
+	CorsPolicies  map[string]*Cors       `mapstructure:"CORS_POLICIES" desc:"Named CORS policies routes can select with CORS_POLICY"`
+	Hystrix       Hystrix                `mapstructure:"HYSTRIX" desc:"Circuit breakers of outbound calls"`
+	AccessLog     AccessLog              `mapstructure:"ACCESS_LOG" desc:"Access log of the public listener"`
+	Tracing       Tracing                `mapstructure:"TRACING" desc:"Distributed tracing"`
+	RequestID     RequestID              `mapstructure:"REQUEST_ID" desc:"Acceptance of inbound X-Request-ID headers"`
+	FeatureFlags  map[string]FeatureFlag `mapstructure:"FEATURE_FLAGS" desc:"Feature flags keyed by name"`
+	RateLimits    map[string]*RateLimit  `mapstructure:"RATE_LIMITS" desc:"Named rate limits routes can select with RATE_LIMIT"`
+	Compression   Compression            `mapstructure:"COMPRESSION" desc:"Response compression of routes using the compress middleware"`
+	ResponseCache ResponseCache          `mapstructure:"RESPONSE_CACHE" desc:"Response cache of routes using the cache middleware"`
+	// ConcurrencyLimit is shared by all routes of the public listener, routes can add their own.
+	ConcurrencyLimit ConcurrencyLimit `mapstructure:"CONCURRENCY_LIMIT" desc:"Adaptive limit of concurrent requests to the public listener"`
+	// Routes of the public listener keyed by handler name, see httpserver.RouteRegistry.
+	Routes     map[string]Route `mapstructure:"ROUTES" desc:"Routes of the public listener keyed by handler name"`
+	HttpServer *HttpServer      `json:"httpServer" desc:"Public HTTP listener"`
+	// AdminServer is the listener for metrics, pprof and health checks.
+	AdminServer *HttpServer `json:"adminServer" desc:"Admin listener for metrics, pprof and health checks"`
 }
 
 var Configuration Configurations
 
-func InitConfigurations() Configurations {
+// InitConfigurations loads all configuration layers into Configuration.
+// An error is returned when the files cannot be read or the result does not pass Validate.
+func InitConfigurations(loader *Loader) (Configurations, error) {
 	fmt.Println("Initializing configurations...")
-	viper.SetConfigName("default")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath("../../config/")
-	err := viper.ReadInConfig()
+	cfg, err := loader.Load()
 	if err != nil {
-		panic(fmt.Errorf("Fatal error reading config file: %w", err))
-	}
-	replacer := strings.NewReplacer(".", "_")
-	viper.SetEnvKeyReplacer(replacer)
-	viper.AutomaticEnv()
-
-	if err := viper.ReadInConfig(); err != nil {
-		panic(fmt.Errorf("Fatal error reading config file: %w", err))
+		return cfg, err
 	}
-
-	if err = viper.Unmarshal(&Configuration); err != nil {
-		panic(fmt.Errorf("unable to decode into struct: %w", err))
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
 	}
-
-	return Configuration
+	Configuration = cfg
+	return Configuration, nil
 }
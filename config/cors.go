@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cors is a cross-origin resource sharing policy.
+//
+// ORIGINS entries are matched against the Origin header in one of three forms:
+// an exact origin such as https://reviews.swiggy.com, a wildcard subdomain such as
+// https://*.swiggy.com which matches every subdomain but not swiggy.com itself, or a
+// regular expression prefixed with "regex:" matched against the whole origin.
+// "*" allows every origin and cannot be combined with ALLOW_CREDENTIALS.
+type Cors struct {
+	Origins          []string      `mapstructure:"ORIGINS" desc:"Allowed origins: exact, https://*.example.com or regex:<expression>"`
+	Methods          []string      `mapstructure:"METHODS" enum:"GET,HEAD,POST,PUT,PATCH,DELETE,CONNECT,OPTIONS,TRACE" desc:"Methods allowed in cross-origin requests, empty allows GET, HEAD and POST"`
+	Headers          []string      `mapstructure:"HEADERS" desc:"Request headers allowed in cross-origin requests, * allows all"`
+	ExposeHeaders    []string      `mapstructure:"EXPOSE_HEADERS" desc:"Response headers scripts are allowed to read"`
+	AllowCredentials bool          `mapstructure:"ALLOW_CREDENTIALS" desc:"Allow cookies and authorization headers in cross-origin requests"`
+	MaxAge           time.Duration `mapstructure:"MAX_AGE" desc:"How long browsers may cache a preflight response, 0 leaves it to the browser"`
+}
+
+// OriginPattern is one parsed entry of Cors.Origins.
+type OriginPattern struct {
+	exact  string
+	scheme string // with a wildcard subdomain
+	suffix string // ".example.com" with a wildcard subdomain
+	regex  *regexp.Regexp
+	any    bool
+}
+
+// Match reports whether the Origin header value origin is allowed by p.
+func (p OriginPattern) Match(origin string) bool {
+	switch {
+	case p.any:
+		return true
+	case p.regex != nil:
+		return p.regex.MatchString(origin)
+	case p.suffix != "":
+		rest, ok := strings.CutPrefix(origin, p.scheme+"://")
+		if !ok {
+			return false
+		}
+		host := strings.ToLower(rest)
+		return strings.HasSuffix(host, p.suffix) && len(host) > len(p.suffix) && !strings.ContainsAny(host, "/?#@")
+	}
+	return strings.EqualFold(origin, p.exact)
+}
+
+// ParsedOrigins parses Origins, see Cors for the supported forms.
+func (c *Cors) ParsedOrigins() ([]OriginPattern, error) {
+	patterns := make([]OriginPattern, 0, len(c.Origins))
+	for _, o := range c.Origins {
+		p, err := parseOriginPattern(strings.TrimSpace(o))
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+func parseOriginPattern(o string) (OriginPattern, error) {
+	if o == "*" {
+		return OriginPattern{any: true}, nil
+	}
+	if expr, ok := strings.CutPrefix(o, "regex:"); ok {
+		// Anchor the expression, a partial match of an origin is never what is meant.
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return OriginPattern{}, fmt.Errorf("invalid origin expression %q: %v", expr, err)
+		}
+		return OriginPattern{regex: re}, nil
+	}
+	u, err := url.Parse(o)
+	if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return OriginPattern{}, fmt.Errorf("invalid origin %q, expected scheme://host[:port]", o)
+	}
+	if host, ok := strings.CutPrefix(u.Host, "*."); ok {
+		if host == "" || strings.Contains(host, "*") {
+			return OriginPattern{}, fmt.Errorf("invalid wildcard origin %q", o)
+		}
+		return OriginPattern{scheme: u.Scheme, suffix: "." + strings.ToLower(host)}, nil
+	}
+	if strings.Contains(u.Host, "*") {
+		return OriginPattern{}, fmt.Errorf("invalid origin %q, only a leading *. subdomain wildcard is supported", o)
+	}
+	return OriginPattern{exact: strings.TrimSuffix(o, "/")}, nil
+}
+
+// CorsPolicy returns the policy name selects, the empty name is the CORS section.
+// It returns nil for unknown names. The result is the same pointer for every call on c.
+func (c *Configurations) CorsPolicy(name string) *Cors {
+	if name == "" {
+		return &c.Cors
+	}
+	return c.CorsPolicies[strings.ToLower(name)]
+}
+
+func (c *Cors) validate(v *validator, path string) {
+	if len(c.Origins) == 0 {
+		v.addf(joinPath(path, "ORIGINS"), "must list at least one origin")
+	}
+	for i, o := range c.Origins {
+		originPath := fmt.Sprintf("%s[%d]", joinPath(path, "ORIGINS"), i)
+		o = strings.TrimSpace(o)
+		if o == "" {
+			v.addf(originPath, "must not be empty")
+			continue
+		}
+		if _, err := parseOriginPattern(o); err != nil {
+			v.addf(originPath, "%v", err)
+		}
+		if o == "*" && c.AllowCredentials {
+			v.addf(originPath, "* cannot be combined with ALLOW_CREDENTIALS, list the origins instead")
+		}
+	}
+	for i, m := range c.Methods {
+		if !validMethod(m) {
+			v.addf(fmt.Sprintf("%s[%d]", joinPath(path, "METHODS"), i), "unknown HTTP method %q", m)
+		}
+	}
+	if c.MaxAge < 0 {
+		v.addf(joinPath(path, "MAX_AGE"), "must not be negative, got %v", c.MaxAge)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
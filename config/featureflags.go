@@ -0,0 +1,41 @@
+package config
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// FeatureFlag is an on/off toggle, see package featureflags for how it is evaluated.
+// A flag is on for every targeted customer, device or source and for ROLLOUT_PERCENT
+// of the remaining requests, bucketed by BUCKET_BY. ENABLED switches it off for everyone.
+type FeatureFlag struct {
+	Enabled        bool     `mapstructure:"ENABLED" desc:"Master switch, a disabled flag is off for everyone"`
+	RolloutPercent int      `mapstructure:"ROLLOUT_PERCENT" desc:"Share of requests in percent the flag is on for"`
+	BucketBy       string   `mapstructure:"BUCKET_BY" enum:"customerId,deviceId,source" desc:"Request context value the rollout is bucketed by, empty is customerId"`
+	CustomerIDs    []string `mapstructure:"CUSTOMER_IDS" desc:"Customers the flag is always on for"`
+	DeviceIDs      []string `mapstructure:"DEVICE_IDS" desc:"Devices the flag is always on for"`
+	Sources        []string `mapstructure:"SOURCES" desc:"Request sources the flag is always on for"`
+}
+
+// FeatureFlagBucketKeys are the request context keys a rollout can be bucketed by.
+var FeatureFlagBucketKeys = []string{"customerId", "deviceId", "source"}
+
+func validateFeatureFlags(v *validator, path string, flags map[string]FeatureFlag) {
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		flag := flags[name]
+		flagPath := joinPath(path, name)
+		if flag.RolloutPercent < 0 || flag.RolloutPercent > 100 {
+			v.addf(joinPath(flagPath, "ROLLOUT_PERCENT"), "%d is out of range 0-100", flag.RolloutPercent)
+		}
+		if flag.BucketBy != "" && !slices.Contains(FeatureFlagBucketKeys, flag.BucketBy) {
+			v.addf(joinPath(flagPath, "BUCKET_BY"), "unknown key %q, expected one of %s",
+				flag.BucketBy, strings.Join(FeatureFlagBucketKeys, ", "))
+		}
+	}
+}
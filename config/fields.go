@@ -0,0 +1,110 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field is one node of the configuration model, either a section or a leaf value.
+type field struct {
+	key   string // viper key, e.g. httpserver.tls.enabled
+	flag  string // flag name, e.g. http-server.tls.enabled
+	depth int
+	leaf  bool
+	sf    reflect.StructField
+	typ   reflect.Type  // field type with pointers removed
+	value reflect.Value // invalid below a nil pointer
+}
+
+// walkFields visits every field of the struct v points to, sections before their children.
+func walkFields(v reflect.Value, visit func(f field)) {
+	walkStruct(v, "", "", 0, visit)
+}
+
+func walkStruct(v reflect.Value, keyPrefix, flagPrefix string, depth int, visit func(f field)) {
+	t := v.Type()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	v = indirect(v)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := fieldName(sf)
+		f := field{
+			key:   keyPrefix + strings.ToLower(name),
+			flag:  flagPrefix + flagName(name),
+			depth: depth,
+			sf:    sf,
+			typ:   sf.Type,
+		}
+		for f.typ.Kind() == reflect.Pointer {
+			f.typ = f.typ.Elem()
+		}
+		if v.IsValid() {
+			f.value = indirect(v.Field(i))
+		}
+		f.leaf = f.typ.Kind() != reflect.Struct
+		visit(f)
+		if !f.leaf {
+			next := f.value
+			if !next.IsValid() {
+				// Keep walking the type below a nil pointer.
+				next = reflect.Zero(reflect.PointerTo(f.typ))
+			}
+			walkStruct(next, f.key+".", f.flag+".", depth+1, visit)
+		}
+	}
+}
+
+// fieldName is the name mapstructure decodes the field from.
+func fieldName(f reflect.StructField) string {
+	if tag, ok := f.Tag.Lookup("mapstructure"); ok {
+		if name := strings.Split(tag, ",")[0]; name != "" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+// indirect follows pointers, it returns the invalid Value for nil pointers.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// flagName turns a config name into kebab case: HttpServer -> http-server, TTL_SECS -> ttl-secs,
+// TCPKeepAlive -> tcp-keep-alive.
+func flagName(name string) string {
+	if strings.ToUpper(name) == name {
+		return strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+	}
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if r == '_' {
+			b.WriteRune('-')
+			continue
+		}
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune('-')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
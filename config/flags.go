@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// flagKeyAnnotation stores the config key on flags registered by RegisterFlags.
+const flagKeyAnnotation = "config-key"
+
+// RegisterFlags adds a flag for every leaf of Configurations, e.g. --http-server.port or
+// --big-cache.ttl-secs. Flags override every other layer when passed to the Loader.
+// Names already defined in fs are left alone and map sections such as HYSTRIX.COMMANDS get no flags.
+func RegisterFlags(fs *pflag.FlagSet) {
+	walkFields(reflect.ValueOf(&Configurations{}), func(f field) {
+		if !f.leaf || fs.Lookup(f.flag) != nil {
+			return
+		}
+		usage := f.sf.Tag.Get("desc")
+		switch {
+		case f.typ == durationType:
+			fs.Duration(f.flag, 0, usage)
+		case f.typ.Kind() == reflect.String:
+			fs.String(f.flag, "", usage)
+		case f.typ.Kind() == reflect.Int:
+			fs.Int(f.flag, 0, usage)
+		case f.typ.Kind() == reflect.Bool:
+			fs.Bool(f.flag, false, usage)
+		case f.typ.Kind() == reflect.Float64:
+			fs.Float64(f.flag, 0, usage)
+		case f.typ.Kind() == reflect.Slice && f.typ.Elem().Kind() == reflect.String:
+			fs.StringSlice(f.flag, nil, usage)
+		default:
+			return
+		}
+		fs.SetAnnotation(f.flag, flagKeyAnnotation, []string{f.key})
+	})
+}
+
+// flagKey returns the config key a flag overrides. Flags not registered
+// through RegisterFlags override the key of the same name.
+func flagKey(f *pflag.Flag) string {
+	if keys := f.Annotations[flagKeyAnnotation]; len(keys) == 1 {
+		return keys[0]
+	}
+	return strings.ToLower(f.Name)
+}
+
+// PrintUsage writes the configuration tree with the flag, environment variable, default value
+// and description of every field. defaults may be nil when the config files could not be loaded,
+// secretKeys are hidden like in Redacted.
+func PrintUsage(w io.Writer, defaults *Configurations, secretKeys map[string]bool) {
+	v := reflect.ValueOf(defaults)
+	if defaults == nil {
+		v = reflect.ValueOf(&Configurations{})
+	}
+	walkFields(v, func(f field) {
+		indent := strings.Repeat("  ", f.depth)
+		desc := f.sf.Tag.Get("desc")
+		if !f.leaf {
+			fmt.Fprintf(w, "%s%s: %s\n", indent, fieldName(f.sf), desc)
+			return
+		}
+
+		if f.typ.Kind() == reflect.Map {
+			fmt.Fprintf(w, "%s%s  (config files only)\n", indent, fieldName(f.sf))
+		} else {
+			fmt.Fprintf(w, "%s%s  --%s  $%s\n", indent, fieldName(f.sf), f.flag, envName(f.key))
+		}
+		if desc != "" {
+			fmt.Fprintf(w, "%s    %s\n", indent, desc)
+		}
+		if defaults != nil && f.value.IsValid() && !f.value.IsZero() {
+			fmt.Fprintf(w, "%s    default: %v\n", indent, displayValue(f, secretKeys))
+		}
+	})
+}
+
+func displayValue(f field, secretKeys map[string]bool) any {
+	if isSecretField(f.sf) || secretKeys[f.key] {
+		return RedactedValue
+	}
+	return f.value.Interface()
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlagName(t *testing.T) {
+	for name, want := range map[string]string{
+		"HttpServer":          "http-server",
+		"TTL_SECS":            "ttl-secs",
+		"readTimeout":         "read-timeout",
+		"TCPKeepAlive":        "tcp-keep-alive",
+		"ClientCAFile":        "client-ca-file",
+		"Environment":         "environment",
+		"TLS":                 "tls",
+		"MaxHeaderBytes":      "max-header-bytes",
+		"HARD_MAX_CACHE_SIZE": "hard-max-cache-size",
+	} {
+		assert.Equal(t, want, flagName(name), name)
+	}
+}
+
+func TestRegisterFlags(t *testing.T) {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	RegisterFlags(fs)
+
+	for _, name := range []string{"http-server.port", "big-cache.ttl-secs", "admin-server.tls.cipher-suites", "hystrix.defaults.timeout-ms"} {
+		f := fs.Lookup(name)
+		if assert.NotNil(t, f, name) {
+			assert.NotEmpty(t, f.Usage, name)
+		}
+	}
+	assert.Equal(t, "httpserver.port", flagKey(fs.Lookup("http-server.port")))
+	assert.Nil(t, fs.Lookup("hystrix.commands"))
+}
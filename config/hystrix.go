@@ -1,13 +1,131 @@
 package config
 
-func ConfigureHsytrixCommands() {
+import (
+	"sort"
 
-	// hystrix.ConfigureCommand(Configuration.LaunchDashHysterixConfig.Name, hystrix.CommandConfig{
-	// 	Timeout:                Configuration.LaunchDashHysterixConfig.Timeout,
-	// 	MaxConcurrentRequests:  Configuration.LaunchDashHysterixConfig.MaxConcurrentRequest,
-	// 	RequestVolumeThreshold: Configuration.LaunchDashHysterixConfig.RequestVolumeThreshold,
-	// 	SleepWindow:            Configuration.LaunchDashHysterixConfig.SleepWindow,
-	// 	ErrorPercentThreshold:  Configuration.LaunchDashHysterixConfig.ErrorPercentageThreshold,
-	// })
+	"github.com/afex/hystrix-go/hystrix"
+)
 
+// HystrixCommand holds the circuit breaker settings every command inherits.
+// Zero values are inherited from the hystrix-go defaults.
+type HystrixCommand struct {
+	Timeout                int `mapstructure:"TIMEOUT_MS" desc:"Command timeout in milliseconds"`
+	MaxConcurrentRequests  int `mapstructure:"MAX_CONCURRENT_REQUESTS" desc:"Maximum concurrent executions of the command"`
+	RequestVolumeThreshold int `mapstructure:"REQUEST_VOLUME_THRESHOLD" desc:"Minimum requests in the rolling window before the circuit can trip"`
+	SleepWindow            int `mapstructure:"SLEEP_WINDOW_MS" desc:"Time in milliseconds an open circuit waits before probing the downstream"`
+	ErrorPercentThreshold  int `mapstructure:"ERROR_PERCENT_THRESHOLD" desc:"Error percentage which opens the circuit"`
+}
+
+// HystrixOverride holds the circuit breaker settings of one command. Unset values are
+// inherited from HYSTRIX.DEFAULTS, explicit ones are kept even when they are 0.
+//
+// hystrix-go takes 0 for unset, so a 0 becomes the smallest value it accepts: a sleep
+// window of 1 ms, a volume threshold of 1 request and an error threshold of 1 percent.
+// TIMEOUT_MS and MAX_CONCURRENT_REQUESTS cannot be 0.
+type HystrixOverride struct {
+	Timeout                *int `mapstructure:"TIMEOUT_MS" desc:"Command timeout in milliseconds"`
+	MaxConcurrentRequests  *int `mapstructure:"MAX_CONCURRENT_REQUESTS" desc:"Maximum concurrent executions of the command"`
+	RequestVolumeThreshold *int `mapstructure:"REQUEST_VOLUME_THRESHOLD" desc:"Minimum requests in the rolling window before the circuit can trip"`
+	SleepWindow            *int `mapstructure:"SLEEP_WINDOW_MS" desc:"Time in milliseconds an open circuit waits before probing the downstream"`
+	ErrorPercentThreshold  *int `mapstructure:"ERROR_PERCENT_THRESHOLD" desc:"Error percentage which opens the circuit"`
+}
+
+// Hystrix declares the circuit breakers of the outbound calls.
+// Command names are lower-cased by the config loader, use lower-case names in hystrix.Do.
+type Hystrix struct {
+	Defaults HystrixCommand             `mapstructure:"DEFAULTS" desc:"Settings inherited by every command"`
+	Commands map[string]HystrixOverride `mapstructure:"COMMANDS" desc:"Settings per command name"`
+}
+
+// CommandConfigs returns the settings of every declared command with the defaults filled in.
+func (h *Hystrix) CommandConfigs() map[string]hystrix.CommandConfig {
+	cmds := make(map[string]hystrix.CommandConfig, len(h.Commands))
+	for name, cmd := range h.Commands {
+		cmds[name] = hystrix.CommandConfig{
+			Timeout:                setting(cmd.Timeout, h.Defaults.Timeout, hystrix.DefaultTimeout),
+			MaxConcurrentRequests:  setting(cmd.MaxConcurrentRequests, h.Defaults.MaxConcurrentRequests, hystrix.DefaultMaxConcurrent),
+			RequestVolumeThreshold: max(1, setting(cmd.RequestVolumeThreshold, h.Defaults.RequestVolumeThreshold, hystrix.DefaultVolumeThreshold)),
+			SleepWindow:            max(1, setting(cmd.SleepWindow, h.Defaults.SleepWindow, hystrix.DefaultSleepWindow)),
+			ErrorPercentThreshold:  max(1, setting(cmd.ErrorPercentThreshold, h.Defaults.ErrorPercentThreshold, hystrix.DefaultErrorPercentThreshold)),
+		}
+	}
+	return cmds
+}
+
+// ConfigureHystrixCommands configures every declared command in hystrix.
+// It can be called again on reload, commands that were removed keep their last settings.
+// The concurrency limit of a circuit which already ran is not changed by hystrix-go.
+func ConfigureHystrixCommands(h Hystrix) {
+	hystrix.Configure(h.CommandConfigs())
+}
+
+func (h *Hystrix) validate(v *validator, path string) {
+	h.Defaults.validate(v, joinPath(path, "DEFAULTS"))
+	names := make([]string, 0, len(h.Commands))
+	for name := range h.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := h.Commands[name]
+		cmd.validate(v, joinPath(path, "COMMANDS."+name))
+	}
+}
+
+func (c *HystrixOverride) validate(v *validator, path string) {
+	fields := []struct {
+		name     string
+		value    *int
+		positive bool
+	}{
+		{"TIMEOUT_MS", c.Timeout, true},
+		{"MAX_CONCURRENT_REQUESTS", c.MaxConcurrentRequests, true},
+		{"REQUEST_VOLUME_THRESHOLD", c.RequestVolumeThreshold, false},
+		{"SLEEP_WINDOW_MS", c.SleepWindow, false},
+		{"ERROR_PERCENT_THRESHOLD", c.ErrorPercentThreshold, false},
+	}
+	for _, f := range fields {
+		switch {
+		case f.value == nil:
+		case *f.value < 0:
+			v.addf(joinPath(path, f.name), "must not be negative, got %d", *f.value)
+		case *f.value == 0 && f.positive:
+			v.addf(joinPath(path, f.name), "must be positive, got 0")
+		}
+	}
+	if c.ErrorPercentThreshold != nil && *c.ErrorPercentThreshold > 100 {
+		v.addf(joinPath(path, "ERROR_PERCENT_THRESHOLD"), "must be at most 100, got %d", *c.ErrorPercentThreshold)
+	}
+}
+
+func (c *HystrixCommand) validate(v *validator, path string) {
+	fields := []struct {
+		name  string
+		value int
+	}{
+		{"TIMEOUT_MS", c.Timeout},
+		{"MAX_CONCURRENT_REQUESTS", c.MaxConcurrentRequests},
+		{"REQUEST_VOLUME_THRESHOLD", c.RequestVolumeThreshold},
+		{"SLEEP_WINDOW_MS", c.SleepWindow},
+		{"ERROR_PERCENT_THRESHOLD", c.ErrorPercentThreshold},
+	}
+	for _, f := range fields {
+		if f.value < 0 {
+			v.addf(joinPath(path, f.name), "must not be negative, got %d", f.value)
+		}
+	}
+	if c.ErrorPercentThreshold > 100 {
+		v.addf(joinPath(path, "ERROR_PERCENT_THRESHOLD"), "must be at most 100, got %d", c.ErrorPercentThreshold)
+	}
+}
+
+// setting returns the override when it is set, otherwise the default unless it is 0, otherwise fallback.
+func setting(override *int, def, fallback int) int {
+	switch {
+	case override != nil:
+		return *override
+	case def != 0:
+		return def
+	}
+	return fallback
 }
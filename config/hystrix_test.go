@@ -0,0 +1,82 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestHystrix_CommandConfigs(t *testing.T) {
+	h := Hystrix{
+		Defaults: HystrixCommand{Timeout: 1000, MaxConcurrentRequests: 100, SleepWindow: 5000, ErrorPercentThreshold: 50},
+		Commands: map[string]HystrixOverride{
+			"location_provider": {Timeout: intPtr(300)},
+			// Explicit zeros are kept rather than replaced by the defaults.
+			"user_lists": {RequestVolumeThreshold: intPtr(0), SleepWindow: intPtr(0), ErrorPercentThreshold: intPtr(0)},
+		},
+	}
+
+	assert.Equal(t, map[string]hystrix.CommandConfig{
+		"location_provider": {
+			Timeout:                300,
+			MaxConcurrentRequests:  100,
+			RequestVolumeThreshold: hystrix.DefaultVolumeThreshold,
+			SleepWindow:            5000,
+			ErrorPercentThreshold:  50,
+		},
+		"user_lists": {
+			Timeout:                1000,
+			MaxConcurrentRequests:  100,
+			RequestVolumeThreshold: 1,
+			SleepWindow:            1,
+			ErrorPercentThreshold:  1,
+		},
+	}, h.CommandConfigs())
+}
+
+func TestHystrixOverride_Validate(t *testing.T) {
+	cfg := validConfigurations()
+	cfg.Hystrix.Commands = map[string]HystrixOverride{
+		"a": {Timeout: intPtr(0), MaxConcurrentRequests: intPtr(0), SleepWindow: intPtr(0), ErrorPercentThreshold: intPtr(101)},
+		"b": {RequestVolumeThreshold: intPtr(-1), ErrorPercentThreshold: intPtr(0)},
+	}
+
+	var verr ValidationError
+	require.ErrorAs(t, cfg.Validate(), &verr)
+	paths := make([]string, 0, len(verr))
+	for _, fe := range verr {
+		paths = append(paths, fe.Path)
+	}
+	assert.Equal(t, []string{
+		"HYSTRIX.COMMANDS.a.TIMEOUT_MS",
+		"HYSTRIX.COMMANDS.a.MAX_CONCURRENT_REQUESTS",
+		"HYSTRIX.COMMANDS.a.ERROR_PERCENT_THRESHOLD",
+		"HYSTRIX.COMMANDS.b.REQUEST_VOLUME_THRESHOLD",
+	}, paths)
+}
+
+func TestHystrix_LoadOverrides(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "default.yaml", `
+HYSTRIX:
+  DEFAULTS:
+    SLEEP_WINDOW_MS: 5000
+  COMMANDS:
+    user_lists:
+      SLEEP_WINDOW_MS: 0
+      TIMEOUT_MS: 500
+`)
+	cfg, err := NewLoader(Options{Path: dir}).Load()
+	require.NoError(t, err)
+	cmd := cfg.Hystrix.Commands["user_lists"]
+	assert.Equal(t, intPtr(0), cmd.SleepWindow)
+	assert.Equal(t, intPtr(500), cmd.Timeout)
+	assert.Nil(t, cmd.ErrorPercentThreshold)
+	assert.Equal(t, 1, cfg.Hystrix.CommandConfigs()["user_lists"].SleepWindow)
+}
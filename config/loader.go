@@ -0,0 +1,261 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	// EnvConfigPath points to a config directory or to the defaults file.
+	EnvConfigPath = "CONFIG_PATH"
+	// EnvEnvironment selects the <environment>.yaml layer.
+	EnvEnvironment = "ENVIRONMENT"
+
+	defaultConfigName = "default"
+	localConfigName   = "local"
+	configExt         = ".yaml"
+)
+
+// Directories searched for default.yaml when no path is given.
+// ../../config keeps `go run .` from cmd/server working.
+var defaultSearchPaths = []string{"./config", "../../config"}
+
+// Source names the layer a configuration value was taken from.
+type Source string
+
+const (
+	SourceDefaults    Source = "defaults"
+	SourceEnvironment Source = "environment file"
+	SourceLocal       Source = "local override"
+	SourceEnvVar      Source = "environment variable"
+	SourceFlag        Source = "flag"
+)
+
+// Sources maps every configuration key to the layer its final value came from.
+type Sources map[string]Source
+
+func (s Sources) String() string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s = %s\n", k, s[k])
+	}
+	return b.String()
+}
+
+type Options struct {
+	// Path is a config directory or the defaults file in it.
+	// Falls back to $CONFIG_PATH, then to ./config and ../../config.
+	Path string
+	// Environment selects <environment>.yaml next to the defaults file.
+	// Falls back to $ENVIRONMENT and then to the ENVIRONMENT value of the defaults file.
+	Environment string
+	// Flags are applied on top of every other layer, see RegisterFlags.
+	// Only flags that were set on the command line take part.
+	Flags *pflag.FlagSet
+}
+
+// Loader reads the configuration in layers, later layers win:
+//
+//	default.yaml -> <environment>.yaml -> local.yaml -> environment variables -> flags
+//
+// The environment and local files are optional.
+// Values like file:///var/run/secrets/db-pass or env://DB_PASS are then resolved through
+// the registered SecretResolvers, on every load.
+type Loader struct {
+	opts    Options
+	mu      sync.RWMutex
+	files   []string
+	sources Sources
+	// secretKeys are the keys whose value was resolved from a secret reference.
+	secretKeys map[string]bool
+}
+
+func NewLoader(opts Options) *Loader {
+	return &Loader{opts: opts}
+}
+
+// Load reads all layers from scratch and decodes them.
+func (l *Loader) Load() (Configurations, error) {
+	var cfg Configurations
+
+	defaultsFile, err := l.defaultsFile()
+	if err != nil {
+		return cfg, err
+	}
+	dir := filepath.Dir(defaultsFile)
+
+	v := viper.New()
+	sources := make(Sources)
+	var files []string
+
+	merge := func(file string, source Source, optional bool) error {
+		layer := viper.New()
+		layer.SetConfigFile(file)
+		if err := layer.ReadInConfig(); err != nil {
+			if optional && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("error reading config file %s: %w", file, err)
+		}
+		if err := v.MergeConfigMap(layer.AllSettings()); err != nil {
+			return fmt.Errorf("error merging config file %s: %w", file, err)
+		}
+		for _, k := range layer.AllKeys() {
+			sources[k] = source
+		}
+		files = append(files, file)
+		return nil
+	}
+
+	if err := merge(defaultsFile, SourceDefaults, false); err != nil {
+		return cfg, err
+	}
+	if env := l.environment(v); env != "" {
+		if err := merge(filepath.Join(dir, strings.ToLower(env)+configExt), SourceEnvironment, true); err != nil {
+			return cfg, err
+		}
+	}
+	if err := merge(filepath.Join(dir, localConfigName+configExt), SourceLocal, true); err != nil {
+		return cfg, err
+	}
+
+	// Keys of the model are bound explicitly so that env vars work for values missing in every file.
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for _, k := range Keys() {
+		v.BindEnv(k)
+	}
+	for _, k := range v.AllKeys() {
+		if _, ok := os.LookupEnv(envName(k)); ok {
+			sources[k] = SourceEnvVar
+		}
+	}
+
+	if l.opts.Flags != nil {
+		known := make(map[string]bool)
+		for _, k := range v.AllKeys() {
+			known[k] = true
+		}
+		l.opts.Flags.Visit(func(f *pflag.Flag) {
+			key := flagKey(f)
+			if !known[key] {
+				return
+			}
+			if sv, ok := f.Value.(pflag.SliceValue); ok {
+				v.Set(key, sv.GetSlice())
+			} else {
+				v.Set(key, f.Value.String())
+			}
+			sources[key] = SourceFlag
+		})
+	}
+
+	settings := v.AllSettings()
+	secretKeys, err := resolveSecrets(context.Background(), settings)
+	if err != nil {
+		return cfg, err
+	}
+	resolved := viper.New()
+	if err := resolved.MergeConfigMap(settings); err != nil {
+		return cfg, err
+	}
+	if err := resolved.Unmarshal(&cfg); err != nil {
+		return cfg, fmt.Errorf("unable to decode into struct: %w", err)
+	}
+
+	l.mu.Lock()
+	l.files = files
+	l.sources = sources
+	l.secretKeys = secretKeys
+	l.mu.Unlock()
+	return cfg, nil
+}
+
+// Sources reports the layer of every key of the last successful Load.
+func (l *Loader) Sources() Sources {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.sources
+}
+
+// SecretKeys returns the keys of the last successful Load whose value came from a secret reference.
+func (l *Loader) SecretKeys() map[string]bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.secretKeys
+}
+
+// Files returns the config files that took part in the last successful Load.
+func (l *Loader) Files() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.files
+}
+
+func (l *Loader) defaultsFile() (string, error) {
+	path := l.opts.Path
+	if path == "" {
+		path = os.Getenv(EnvConfigPath)
+	}
+	if path != "" {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("config path %s: %w", path, err)
+		}
+		if fi.IsDir() {
+			return filepath.Join(path, defaultConfigName+configExt), nil
+		}
+		return path, nil
+	}
+
+	for _, dir := range defaultSearchPaths {
+		file := filepath.Join(dir, defaultConfigName+configExt)
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("no %s%s found in %v, set --config or $%s",
+		defaultConfigName, configExt, defaultSearchPaths, EnvConfigPath)
+}
+
+func (l *Loader) environment(v *viper.Viper) string {
+	if l.opts.Environment != "" {
+		return l.opts.Environment
+	}
+	if env := os.Getenv(EnvEnvironment); env != "" {
+		return env
+	}
+	return v.GetString("environment")
+}
+
+func envName(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Keys returns the viper key of every leaf field of Configurations, e.g. "big_cache.ttl_secs".
+func Keys() []string {
+	var keys []string
+	walkFields(reflect.ValueOf(&Configurations{}), func(f field) {
+		if f.leaf {
+			keys = append(keys, f.key)
+		}
+	})
+	return keys
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+}
+
+func TestLoader_Layers(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "default.yaml", `
+APP_NAME: "backend"
+ENVIRONMENT: "STAGING"
+httpServer:
+  port: 8080
+  readTimeout: 5s
+  writeTimeout: 15s
+  idleTimeout: 10s
+`)
+	writeFile(t, dir, "staging.yaml", `
+httpServer:
+  port: 8081
+  readTimeout: 6s
+`)
+	writeFile(t, dir, "local.yaml", `
+httpServer:
+  readTimeout: 7s
+  writeTimeout: 16s
+`)
+	t.Setenv(EnvEnvironment, "")
+	t.Setenv("HTTPSERVER_WRITETIMEOUT", "17s")
+	t.Setenv("HTTPSERVER_HOST", "127.0.0.1")
+
+	t.Setenv("HTTPSERVER_IDLETIMEOUT", "11s")
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	RegisterFlags(flags)
+	require.NoError(t, flags.Parse([]string{"--http-server.idle-timeout=12s", "--cors.origins=https://a.com,https://b.com"}))
+
+	loader := NewLoader(Options{Path: dir, Flags: flags})
+	cfg, err := loader.Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, "backend", cfg.AppName)
+	assert.Equal(t, 8081, cfg.HttpServer.Port)
+	assert.Equal(t, 7*time.Second, cfg.HttpServer.ReadTimeout)
+	assert.Equal(t, 17*time.Second, cfg.HttpServer.WriteTimeout)
+	assert.Equal(t, 12*time.Second, cfg.HttpServer.IdleTimeout)
+	assert.Equal(t, "127.0.0.1", cfg.HttpServer.Host)
+	assert.Equal(t, []string{"https://a.com", "https://b.com"}, cfg.Cors.Origins)
+
+	sources := loader.Sources()
+	assert.Equal(t, SourceDefaults, sources["app_name"])
+	assert.Equal(t, SourceEnvironment, sources["httpserver.port"])
+	assert.Equal(t, SourceLocal, sources["httpserver.readtimeout"])
+	assert.Equal(t, SourceEnvVar, sources["httpserver.writetimeout"])
+	assert.Equal(t, SourceEnvVar, sources["httpserver.host"])
+	assert.Equal(t, SourceFlag, sources["httpserver.idletimeout"])
+	assert.Len(t, loader.Files(), 3)
+}
+
+func TestLoader_MissingPath(t *testing.T) {
+	_, err := NewLoader(Options{Path: filepath.Join(t.TempDir(), "missing")}).Load()
+	assert.Error(t, err)
+}
+
+func TestLoader_ResolvesSecretReferences(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "db-pass", "s3cret\n")
+	writeFile(t, dir, "default.yaml", `
+APP_NAME: env://TEST_APP_NAME
+LOG:
+  LEVEL: file://`+filepath.Join(dir, "db-pass")+`
+CORS:
+  ORIGINS: https://reviews.swiggy.com
+`)
+	t.Setenv(EnvEnvironment, "none")
+	t.Setenv("TEST_APP_NAME", "from-env")
+
+	loader := NewLoader(Options{Path: dir})
+	cfg, err := loader.Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, "from-env", cfg.AppName)
+	assert.Equal(t, "s3cret", cfg.LogConfig.Level)
+	assert.Equal(t, []string{"https://reviews.swiggy.com"}, cfg.Cors.Origins)
+	assert.Equal(t, map[string]bool{"app_name": true, "log.level": true}, loader.SecretKeys())
+
+	redacted := Redacted(&cfg, loader.SecretKeys())
+	assert.Equal(t, RedactedValue, redacted["APP_NAME"])
+	assert.Equal(t, RedactedValue, redacted["LOG"].(map[string]any)["LEVEL"])
+}
+
+func TestLoader_UnresolvableSecretReference(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "default.yaml", "APP_NAME: env://TEST_MISSING_SECRET\n")
+	t.Setenv(EnvEnvironment, "none")
+
+	_, err := NewLoader(Options{Path: dir}).Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "app_name")
+}
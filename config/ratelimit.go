@@ -0,0 +1,112 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Rate limit algorithms, keys and stores.
+const (
+	RateLimitTokenBucket   = "token_bucket"
+	RateLimitSlidingWindow = "sliding_window"
+
+	RateLimitKeyIP         = "ip"
+	RateLimitKeyCustomerID = "customerId"
+	RateLimitKeyDeviceID   = "deviceId"
+	RateLimitKeyAPIKey     = "apiKey"
+
+	RateLimitStoreMemory   = "memory"
+	RateLimitStoreBigCache = "bigcache"
+
+	DefaultRateLimitAPIKeyHeader = "X-API-Key"
+)
+
+var (
+	RateLimitAlgorithms = []string{RateLimitTokenBucket, RateLimitSlidingWindow}
+	RateLimitKeys       = []string{RateLimitKeyIP, RateLimitKeyCustomerID, RateLimitKeyDeviceID, RateLimitKeyAPIKey}
+	RateLimitStores     = []string{RateLimitStoreMemory, RateLimitStoreBigCache}
+)
+
+// RateLimit allows LIMIT requests per WINDOW for every value of KEY. A token bucket holds
+// BURST tokens and refills LIMIT of them per WINDOW, a sliding window weighs the count of
+// the previous window by how much of it still overlaps the last WINDOW.
+//
+// Requests without a customer id, device id or API key are limited by client IP.
+type RateLimit struct {
+	Algorithm    string        `mapstructure:"ALGORITHM" enum:"token_bucket,sliding_window" desc:"Limiting algorithm, empty is token_bucket"`
+	Limit        int           `mapstructure:"LIMIT" desc:"Requests allowed per WINDOW"`
+	Window       time.Duration `mapstructure:"WINDOW" desc:"Period LIMIT applies to"`
+	Burst        int           `mapstructure:"BURST" desc:"Token bucket capacity, 0 uses LIMIT"`
+	Key          string        `mapstructure:"KEY" enum:"ip,customerId,deviceId,apiKey" desc:"What requests are counted by, empty is ip"`
+	APIKeyHeader string        `mapstructure:"API_KEY_HEADER" desc:"Header carrying the API key for KEY apiKey, empty is X-API-Key"`
+	// Store selects where counters live, bigcache shares them with the application cache
+	// and drops them after BIG_CACHE.TTL_SECS.
+	Store string `mapstructure:"STORE" enum:"memory,bigcache" desc:"Where counters are kept, empty is memory"`
+}
+
+// ParsedAlgorithm returns Algorithm with the default filled in.
+func (c *RateLimit) ParsedAlgorithm() string {
+	if c.Algorithm == "" {
+		return RateLimitTokenBucket
+	}
+	return c.Algorithm
+}
+
+// ParsedKey returns Key with the default filled in.
+func (c *RateLimit) ParsedKey() string {
+	if c.Key == "" {
+		return RateLimitKeyIP
+	}
+	return c.Key
+}
+
+// ParsedBurst returns Burst with the default filled in.
+func (c *RateLimit) ParsedBurst() int {
+	if c.Burst == 0 {
+		return c.Limit
+	}
+	return c.Burst
+}
+
+// ParsedAPIKeyHeader returns APIKeyHeader with the default filled in.
+func (c *RateLimit) ParsedAPIKeyHeader() string {
+	if c.APIKeyHeader == "" {
+		return DefaultRateLimitAPIKeyHeader
+	}
+	return c.APIKeyHeader
+}
+
+// ParsedStore returns Store with the default filled in.
+func (c *RateLimit) ParsedStore() string {
+	if c.Store == "" {
+		return RateLimitStoreMemory
+	}
+	return c.Store
+}
+
+// RateLimitPolicy returns the RATE_LIMITS entry name, nil if there is none.
+func (c *Configurations) RateLimitPolicy(name string) *RateLimit {
+	return c.RateLimits[strings.ToLower(name)]
+}
+
+func (c *RateLimit) validate(v *validator, path string) {
+	if !slices.Contains(RateLimitAlgorithms, c.ParsedAlgorithm()) {
+		v.addf(joinPath(path, "ALGORITHM"), "unknown algorithm %q, expected one of %s", c.Algorithm, strings.Join(RateLimitAlgorithms, ", "))
+	}
+	if c.Limit < 1 {
+		v.addf(joinPath(path, "LIMIT"), "must be positive, got %d", c.Limit)
+	}
+	if c.Window <= 0 {
+		v.addf(joinPath(path, "WINDOW"), "must be positive, got %v", c.Window)
+	}
+	if c.Burst < 0 {
+		v.addf(joinPath(path, "BURST"), "must not be negative, got %d", c.Burst)
+	}
+	if !slices.Contains(RateLimitKeys, c.ParsedKey()) {
+		v.addf(joinPath(path, "KEY"), "unknown key %q, expected one of %s", c.Key, strings.Join(RateLimitKeys, ", "))
+	}
+	if !slices.Contains(RateLimitStores, c.ParsedStore()) {
+		v.addf(joinPath(path, "STORE"), "unknown store %q, expected one of %s", c.Store, strings.Join(RateLimitStores, ", "))
+	}
+}
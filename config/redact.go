@@ -0,0 +1,126 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// RedactedValue replaces the value of secret fields.
+const RedactedValue = "[REDACTED]"
+
+// Suffixes of field and key names which are treated as secrets even without a `secret:"true"` tag.
+// Names are compared lower-cased with "_" and "-" removed, so DB_PASSWORD and X-Api-Key match.
+var secretNameSuffixes = []string{"password", "passwd", "secret", "token", "apikey", "privatekey", "credentials"}
+
+var nameSeparators = strings.NewReplacer("_", "", "-", "")
+
+// IsSecretName reports whether a field or key name follows the naming convention for secrets.
+func IsSecretName(name string) bool {
+	name = nameSeparators.Replace(strings.ToLower(name))
+	for _, suffix := range secretNameSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSecretField(f reflect.StructField) bool {
+	if f.Tag.Get("secret") == "true" {
+		return true
+	}
+	return IsSecretName(f.Name) || IsSecretName(fieldName(f))
+}
+
+// Redacted returns the configuration as a tree of maps keyed like the config files,
+// with every secret value replaced by RedactedValue. It is safe to log or serve.
+// secretKeys are additional keys to hide, see Loader.SecretKeys.
+func Redacted(c *Configurations, secretKeys map[string]bool) map[string]any {
+	r := redactor{secretKeys: secretKeys}
+	out, _ := r.redact(reflect.ValueOf(c), "").(map[string]any)
+	return out
+}
+
+// Hash fingerprints the redacted configuration, secrets do not contribute to it.
+func Hash(c *Configurations, secretKeys map[string]bool) string {
+	b, err := json.Marshal(Redacted(c, secretKeys))
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+type redactor struct {
+	secretKeys map[string]bool
+}
+
+func (r redactor) isSecretKey(key string) bool {
+	return r.secretKeys[key]
+}
+
+// redact converts v, key is its viper key which is used to look up secretKeys.
+func (r redactor) redact(v reflect.Value, key string) any {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		out := make(map[string]any, v.NumField())
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := fieldName(f)
+			fieldKey := joinPath(key, strings.ToLower(name))
+			if isSecretField(f) || r.isSecretKey(fieldKey) {
+				out[name] = redactSecret(v.Field(i))
+				continue
+			}
+			out[name] = r.redact(v.Field(i), fieldKey)
+		}
+		return out
+	case reflect.Map:
+		out := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			name := fmt.Sprint(iter.Key().Interface())
+			entryKey := joinPath(key, strings.ToLower(name))
+			if IsSecretName(name) || r.isSecretKey(entryKey) {
+				out[name] = redactSecret(iter.Value())
+				continue
+			}
+			out[name] = r.redact(iter.Value(), entryKey)
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = r.redact(v.Index(i), key)
+		}
+		return out
+	}
+	return v.Interface()
+}
+
+// redactSecret hides the value but keeps whether it was set at all visible.
+func redactSecret(v reflect.Value) any {
+	if v.IsZero() {
+		return ""
+	}
+	return RedactedValue
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	type client struct {
+		URL         string        `mapstructure:"URL"`
+		Signing     string        `mapstructure:"SIGNING" secret:"true"`
+		DBPassword  string        `mapstructure:"DB_PASSWORD"`
+		ClientToken string        `mapstructure:"CLIENT_TOKEN"`
+		Timeout     time.Duration `mapstructure:"TIMEOUT"`
+		Headers     map[string]string
+		EmptySecret string `secret:"true"`
+	}
+
+	out := redactor{}.redact(reflect.ValueOf(client{
+		URL:         "https://example.com",
+		Signing:     "k",
+		DBPassword:  "p",
+		ClientToken: "t",
+		Timeout:     time.Second,
+		Headers:     map[string]string{"X-Api-Key": "abc", "Accept": "json"},
+	}), "")
+
+	assert.Equal(t, map[string]any{
+		"URL":          "https://example.com",
+		"SIGNING":      RedactedValue,
+		"DB_PASSWORD":  RedactedValue,
+		"CLIENT_TOKEN": RedactedValue,
+		"TIMEOUT":      "1s",
+		"Headers":      map[string]any{"X-Api-Key": RedactedValue, "Accept": "json"},
+		"EmptySecret":  "",
+	}, out)
+}
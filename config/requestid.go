@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Defaults for inbound request ids, they admit UUIDs and the ids of common proxies and tracers.
+const (
+	DefaultRequestIDMaxLength = 128
+	DefaultRequestIDPattern   = `[A-Za-z0-9._:-]+`
+)
+
+// RequestID decides which inbound X-Request-ID values are trusted.
+// Ids that are too long or do not match Pattern are replaced by a generated one.
+type RequestID struct {
+	MaxLength int    `mapstructure:"MAX_LENGTH" desc:"Longest accepted inbound request id, 0 uses 128"`
+	Pattern   string `mapstructure:"PATTERN" desc:"Regular expression an inbound request id has to match as a whole, empty allows letters, digits and ._:-"`
+}
+
+// ParsedMaxLength returns MaxLength with the default filled in.
+func (c *RequestID) ParsedMaxLength() int {
+	if c.MaxLength == 0 {
+		return DefaultRequestIDMaxLength
+	}
+	return c.MaxLength
+}
+
+// ParsedPattern compiles Pattern anchored at both ends, empty uses DefaultRequestIDPattern.
+func (c *RequestID) ParsedPattern() (*regexp.Regexp, error) {
+	pattern := c.Pattern
+	if pattern == "" {
+		pattern = DefaultRequestIDPattern
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	return re, nil
+}
+
+func (c *RequestID) validate(v *validator, path string) {
+	if c.MaxLength < 0 {
+		v.addf(joinPath(path, "MAX_LENGTH"), "must not be negative, got %d", c.MaxLength)
+	}
+	if _, err := c.ParsedPattern(); err != nil {
+		v.addf(joinPath(path, "PATTERN"), "%v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ResponseCache holds the switches shared by the cache middleware of all routes.
+type ResponseCache struct {
+	Enabled bool `mapstructure:"ENABLED" desc:"Serve cacheable GET responses of routes with CACHE from the application cache"`
+	// Debug skips the cache so that every request reaches the handler, responses carry X-Cache: BYPASS.
+	Debug bool `mapstructure:"DEBUG" desc:"Debug mode, bypass the cache for every request"`
+}
+
+// RouteCache configures the cache middleware of one route. Entries are keyed by the request
+// path and the listed query parameters, headers and request context values, so requests
+// differing in anything else share an entry.
+//
+// Context values are only set by middlewares listed before cache in MIDDLEWARES, the
+// built-in ones set none but the request id. A key no middleware sets is always empty.
+//
+// Entries live for TTL unless the response asks for less with Cache-Control, and never longer
+// than BIG_CACHE.TTL_SECS.
+type RouteCache struct {
+	TTL         time.Duration `mapstructure:"TTL" desc:"How long responses are served from the cache"`
+	QueryParams []string      `mapstructure:"QUERY_PARAMS" desc:"Query parameters that are part of the cache key"`
+	Headers     []string      `mapstructure:"HEADERS" desc:"Request headers that are part of the cache key"`
+	CtxKeys     []string      `mapstructure:"CTX_KEYS" desc:"Request context values that are part of the cache key, they have to be set by an earlier middleware"`
+	MaxSize     int           `mapstructure:"MAX_SIZE" desc:"Largest response body in bytes that is cached, 0 leaves it to BIG_CACHE.MAX_ENTRY_SIZE"`
+}
+
+func (c *RouteCache) validate(v *validator, path string) {
+	if c.TTL <= 0 {
+		v.addf(joinPath(path, "TTL"), "must be positive, got %v", c.TTL)
+	}
+	if c.MaxSize < 0 {
+		v.addf(joinPath(path, "MAX_SIZE"), "must not be negative, got %d", c.MaxSize)
+	}
+	keys := []struct {
+		name   string
+		values []string
+	}{
+		{"QUERY_PARAMS", c.QueryParams},
+		{"HEADERS", c.Headers},
+		{"CTX_KEYS", c.CtxKeys},
+	}
+	for _, key := range keys {
+		for i, value := range key.values {
+			if strings.TrimSpace(value) == "" {
+				v.addf(fmt.Sprintf("%s[%d]", joinPath(path, key.name), i), "must not be empty")
+			}
+		}
+	}
+}
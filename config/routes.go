@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ETag modes of a route.
+const (
+	ETagStrong = "strong"
+	ETagWeak   = "weak"
+)
+
+// Route mounts one registered handler on the public listener.
+// Routes are keyed by the handler name in ROUTES, names are lower-cased by the config loader.
+type Route struct {
+	Path       string        `mapstructure:"PATH" desc:"Path the handler is served on, gorilla mux path variables are allowed"`
+	Methods    []string      `mapstructure:"METHODS" enum:"GET,HEAD,POST,PUT,PATCH,DELETE,CONNECT,OPTIONS,TRACE" desc:"Allowed methods, empty allows all"`
+	Instrument bool          `mapstructure:"INSTRUMENT" desc:"Record request metrics for the route"`
+	Timeout    time.Duration `mapstructure:"TIMEOUT" desc:"Context deadline of the handler, 0 is unlimited"`
+	// TimeoutStatus is answered when TIMEOUT is exceeded.
+	TimeoutStatus int `mapstructure:"TIMEOUT_STATUS" enum:"503,504" desc:"Status of the error answered when TIMEOUT is exceeded, empty is 504"`
+	// AccessLog overrides ACCESS_LOG.ENABLED for the route when set.
+	AccessLog *bool `mapstructure:"ACCESS_LOG" desc:"Log requests of the route, unset follows ACCESS_LOG.ENABLED"`
+	// CorsPolicy selects a policy of CORS_POLICIES for the cors middleware, empty uses CORS.
+	CorsPolicy string `mapstructure:"CORS_POLICY" desc:"CORS_POLICIES entry used by the cors middleware, empty uses CORS"`
+	// RateLimit selects a policy of RATE_LIMITS for the rate_limit middleware.
+	RateLimit string `mapstructure:"RATE_LIMIT" desc:"RATE_LIMITS entry used by the rate_limit middleware"`
+	// ConcurrencyLimit adds a limit of the route to the one of CONCURRENCY_LIMIT.
+	ConcurrencyLimit *ConcurrencyLimit `mapstructure:"CONCURRENCY_LIMIT" desc:"Adaptive limit of concurrent requests to the route, unset only applies the server-wide one"`
+	// ETag answers conditional requests with ETags the handler set or computed from the response.
+	ETag string `mapstructure:"ETAG" enum:"strong,weak" desc:"Kind of ETag computed for responses to answer conditional requests, empty disables them"`
+	// Cache configures the cache middleware of the route.
+	Cache *RouteCache `mapstructure:"CACHE" desc:"Response cache settings used by the cache middleware"`
+	// Middlewares are applied in order, the first one sees the request first.
+	Middlewares []string `mapstructure:"MIDDLEWARES" desc:"Names of the middlewares wrapping the handler, outermost first"`
+}
+
+// RouteNames returns the handler names of routes in a stable order.
+func RouteNames(routes map[string]Route) []string {
+	names := make([]string, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateRoutes(v *validator, path string, routes map[string]Route, corsPolicies map[string]*Cors, rateLimits map[string]*RateLimit) {
+	paths := make(map[string]string)
+	for _, name := range RouteNames(routes) {
+		route := routes[name]
+		routePath := joinPath(path, name)
+		if !strings.HasPrefix(route.Path, "/") {
+			v.addf(joinPath(routePath, "PATH"), "must start with /, got %q", route.Path)
+		} else if other, ok := paths[route.Path]; ok {
+			v.addf(joinPath(routePath, "PATH"), "%s is already used by route %s", route.Path, other)
+		} else {
+			paths[route.Path] = name
+		}
+		for i, m := range route.Methods {
+			if !validMethod(m) {
+				v.addf(fmt.Sprintf("%s[%d]", joinPath(routePath, "METHODS"), i), "unknown HTTP method %q", m)
+			}
+		}
+		if route.Timeout < 0 {
+			v.addf(joinPath(routePath, "TIMEOUT"), "must not be negative, got %v", route.Timeout)
+		}
+		if route.TimeoutStatus != 0 && route.TimeoutStatus != http.StatusServiceUnavailable && route.TimeoutStatus != http.StatusGatewayTimeout {
+			v.addf(joinPath(routePath, "TIMEOUT_STATUS"), "must be 503 or 504, got %d", route.TimeoutStatus)
+		}
+		if _, ok := corsPolicies[strings.ToLower(route.CorsPolicy)]; route.CorsPolicy != "" && !ok {
+			v.addf(joinPath(routePath, "CORS_POLICY"), "unknown policy %q, declare it in CORS_POLICIES", route.CorsPolicy)
+		}
+		if _, ok := rateLimits[strings.ToLower(route.RateLimit)]; route.RateLimit != "" && !ok {
+			v.addf(joinPath(routePath, "RATE_LIMIT"), "unknown policy %q, declare it in RATE_LIMITS", route.RateLimit)
+		}
+		if route.ConcurrencyLimit != nil {
+			route.ConcurrencyLimit.validate(v, joinPath(routePath, "CONCURRENCY_LIMIT"))
+		}
+		if route.ETag != "" && route.ETag != ETagStrong && route.ETag != ETagWeak {
+			v.addf(joinPath(routePath, "ETAG"), "unknown mode %q, expected %s or %s", route.ETag, ETagStrong, ETagWeak)
+		}
+		if route.Cache != nil {
+			route.Cache.validate(v, joinPath(routePath, "CACHE"))
+		}
+		for i, mw := range route.Middlewares {
+			if strings.TrimSpace(mw) == "" {
+				v.addf(fmt.Sprintf("%s[%d]", joinPath(routePath, "MIDDLEWARES"), i), "must not be empty")
+			}
+		}
+	}
+}
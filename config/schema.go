@@ -0,0 +1,183 @@
+package config
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SchemaDraft is the JSON Schema dialect produced by Schema.
+const SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// durationPattern matches the values time.ParseDuration accepts, e.g. 5s or 1m30s.
+const durationPattern = `^(0|-?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+)$`
+
+// Schema returns a JSON Schema for the config files, generated from Configurations.
+//
+// Property names are the mapstructure tag, else the json tag, else the lower camel case
+// field name, which is how the config files spell them. Descriptions come from the desc
+// tag and enums from the comma separated enum tag. defaults, usually the loaded default
+// layers, provide the default values and may be nil. Secret values never become defaults.
+func Schema(defaults *Configurations, secretKeys map[string]bool) map[string]any {
+	v := reflect.ValueOf(defaults)
+	if defaults == nil {
+		v = reflect.ValueOf(&Configurations{})
+	}
+	s := schemaGenerator{secretKeys: secretKeys, withDefaults: defaults != nil}
+	root := s.object(v, "")
+	root["$schema"] = SchemaDraft
+	root["title"] = "backend configuration"
+	return root
+}
+
+type schemaGenerator struct {
+	secretKeys   map[string]bool
+	withDefaults bool
+}
+
+// object describes the struct v points to, v may be a nil pointer.
+func (s schemaGenerator) object(v reflect.Value, keyPrefix string) map[string]any {
+	props := make(map[string]any)
+	t := v.Type()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	v = indirect(v)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		key := keyPrefix + strings.ToLower(fieldName(sf))
+		var fv reflect.Value
+		if v.IsValid() {
+			fv = v.Field(i)
+		} else {
+			fv = reflect.Zero(reflect.PointerTo(sf.Type))
+		}
+		props[schemaName(sf)] = s.property(sf, fv, key)
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+func (s schemaGenerator) property(sf reflect.StructField, v reflect.Value, key string) map[string]any {
+	typ := sf.Type
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	var prop map[string]any
+	if typ.Kind() == reflect.Struct {
+		prop = s.object(v, key+".")
+	} else {
+		prop = typeSchema(typ)
+		if enum := enumValues(sf, typ); enum != nil {
+			if items, ok := prop["items"].(map[string]any); ok {
+				items["enum"] = enum
+			} else {
+				prop["enum"] = enum
+			}
+		}
+		if def, ok := s.defaultValue(sf, v, key); ok {
+			prop["default"] = def
+		}
+	}
+	if desc := sf.Tag.Get("desc"); desc != "" {
+		prop["description"] = desc
+	}
+	return prop
+}
+
+// typeSchema describes values of typ the way viper decodes them.
+func typeSchema(typ reflect.Type) map[string]any {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch {
+	case typ == durationType:
+		return map[string]any{"type": "string", "pattern": durationPattern}
+	case typ.Kind() == reflect.Struct:
+		return schemaGenerator{}.object(reflect.Zero(reflect.PointerTo(typ)), "")
+	case typ.Kind() == reflect.Slice:
+		// A comma separated string is decoded into a slice as well.
+		return map[string]any{"type": []string{"array", "string"}, "items": typeSchema(typ.Elem())}
+	case typ.Kind() == reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(typ.Elem())}
+	case typ.Kind() == reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{"type": "string"}
+}
+
+func (s schemaGenerator) defaultValue(sf reflect.StructField, v reflect.Value, key string) (any, bool) {
+	v = indirect(v)
+	if !s.withDefaults || !v.IsValid() || v.IsZero() || v.Kind() == reflect.Map {
+		return nil, false
+	}
+	if isSecretField(sf) || s.secretKeys[key] {
+		return nil, false
+	}
+	if v.Type() == durationType {
+		return v.Interface().(time.Duration).String(), true
+	}
+	return v.Interface(), true
+}
+
+// enumValues returns the values of the enum tag typed like the values of typ, or its elements.
+func enumValues(sf reflect.StructField, typ reflect.Type) []any {
+	tag, ok := sf.Tag.Lookup("enum")
+	if !ok {
+		return nil
+	}
+	if typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	var values []any
+	for _, s := range strings.Split(tag, ",") {
+		if typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Int64 {
+			if n, err := strconv.Atoi(s); err == nil {
+				values = append(values, n)
+				continue
+			}
+		}
+		values = append(values, s)
+	}
+	return values
+}
+
+// schemaName is the property name of a field in the config files.
+func schemaName(sf reflect.StructField) string {
+	if _, ok := sf.Tag.Lookup("mapstructure"); ok {
+		return fieldName(sf)
+	}
+	if tag := strings.Split(sf.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+		return tag
+	}
+	return lowerCamel(sf.Name)
+}
+
+// lowerCamel lower-cases the leading word of a Go name: Port -> port, TLS -> tls,
+// TCPKeepAlive -> tcpKeepAlive, ClientCAFile -> clientCAFile.
+func lowerCamel(name string) string {
+	runes := []rune(name)
+	for i := range runes {
+		if !unicode.IsUpper(runes[i]) {
+			break
+		}
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchema(t *testing.T) {
+	defaults := validConfigurations()
+	defaults.HttpServer.ReadTimeout = 5 * time.Second
+	schema := Schema(&defaults, map[string]bool{"app_name": true})
+
+	assert.Equal(t, SchemaDraft, schema["$schema"])
+	props := schema["properties"].(map[string]any)
+	assert.NotContains(t, props["APP_NAME"], "default", "secret keys must not leak into defaults")
+
+	server := props["httpServer"].(map[string]any)["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{
+		"type":        "string",
+		"pattern":     durationPattern,
+		"default":     "5s",
+		"description": "Maximum duration for reading the entire request, including the body",
+	}, server["readTimeout"])
+	assert.Contains(t, server, "tcpKeepAlive")
+
+	tls := server["tls"].(map[string]any)["properties"].(map[string]any)
+	assert.Equal(t, []any{"none", "request", "require", "verify_if_given", "require_and_verify"}, tls["clientAuth"].(map[string]any)["enum"])
+
+	methods := props["CORS"].(map[string]any)["properties"].(map[string]any)["METHODS"].(map[string]any)
+	assert.Contains(t, methods["items"].(map[string]any)["enum"], "OPTIONS")
+
+	route := props["ROUTES"].(map[string]any)["additionalProperties"].(map[string]any)["properties"].(map[string]any)
+	assert.Equal(t, []any{503, 504}, route["TIMEOUT_STATUS"].(map[string]any)["enum"])
+
+	commands := props["HYSTRIX"].(map[string]any)["properties"].(map[string]any)["COMMANDS"].(map[string]any)
+	assert.Contains(t, commands["additionalProperties"].(map[string]any)["properties"], "TIMEOUT_MS")
+}
+
+func TestLowerCamel(t *testing.T) {
+	for name, want := range map[string]string{
+		"Port":         "port",
+		"TLS":          "tls",
+		"TCPKeepAlive": "tcpKeepAlive",
+		"ClientCAFile": "clientCAFile",
+	} {
+		assert.Equal(t, want, lowerCamel(name), name)
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SecretResolver resolves the reference part of a secret reference to the secret value.
+// For file:///var/run/secrets/db-pass the resolver registered for "file" gets "/var/run/secrets/db-pass".
+type SecretResolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// SecretResolverFunc adapts a function to SecretResolver.
+type SecretResolverFunc func(ctx context.Context, ref string) (string, error)
+
+func (f SecretResolverFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+var (
+	secretResolversMu sync.RWMutex
+	secretResolvers   = map[string]SecretResolver{
+		"file": SecretResolverFunc(resolveFileSecret),
+		"env":  SecretResolverFunc(resolveEnvSecret),
+	}
+)
+
+// RegisterSecretResolver makes config values of the form <scheme>://<ref> resolve through r,
+// e.g. a KMS or Vault client. Registering an existing scheme replaces its resolver.
+// Resolvers have to be registered before the configuration is loaded.
+func RegisterSecretResolver(scheme string, r SecretResolver) {
+	secretResolversMu.Lock()
+	defer secretResolversMu.Unlock()
+	secretResolvers[strings.ToLower(scheme)] = r
+}
+
+// secretResolverFor returns the resolver and the reference of value when it is a secret reference.
+// Values with unregistered schemes, such as https:// URLs, are not references.
+func secretResolverFor(value string) (SecretResolver, string, bool) {
+	scheme, ref, ok := strings.Cut(value, "://")
+	if !ok {
+		return nil, "", false
+	}
+	secretResolversMu.RLock()
+	defer secretResolversMu.RUnlock()
+	r, ok := secretResolvers[strings.ToLower(scheme)]
+	return r, ref, ok
+}
+
+// resolveSecrets replaces every secret reference in settings in place and returns the keys it resolved.
+// Errors never contain secret values.
+func resolveSecrets(ctx context.Context, settings map[string]any) (map[string]bool, error) {
+	resolved := make(map[string]bool)
+	v := &validator{}
+
+	var resolve func(key string, value any) any
+	resolve = func(key string, value any) any {
+		switch val := value.(type) {
+		case string:
+			r, ref, ok := secretResolverFor(val)
+			if !ok {
+				return val
+			}
+			secret, err := r.Resolve(ctx, ref)
+			if err != nil {
+				v.addf(key, "failed to resolve secret reference: %v", err)
+				return val
+			}
+			resolved[key] = true
+			return secret
+		case []any:
+			for i := range val {
+				val[i] = resolve(key, val[i])
+			}
+			return val
+		case map[string]any:
+			for k, item := range val {
+				val[k] = resolve(joinPath(key, k), item)
+			}
+			return val
+		}
+		return value
+	}
+	resolve("", settings)
+
+	sort.Slice(v.errs, func(i, j int) bool { return v.errs[i].Path < v.errs[j].Path })
+	return resolved, v.err()
+}
+
+func resolveFileSecret(_ context.Context, path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	// Secrets mounted from files usually end with a newline.
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func resolveEnvSecret(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
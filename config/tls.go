@@ -0,0 +1,111 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TLS configures HTTPS and, optionally, client certificate verification for a listener.
+// Certificate, key and CA files are re-read every ReloadInterval when they change on disk.
+type TLS struct {
+	Enabled  bool   `desc:"Serve HTTPS"`
+	CertFile string `desc:"PEM certificate file"`
+	KeyFile  string `desc:"PEM private key file"`
+	// MinVersion is one of "1.2" or "1.3". Empty defaults to 1.2.
+	MinVersion string `enum:"1.2,1.3" desc:"Minimum TLS version"`
+	// CipherSuites are IANA names, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+	// Empty uses the Go defaults. Ignored for TLS 1.3.
+	CipherSuites []string `desc:"Allowed TLS 1.2 cipher suites by IANA name, empty uses the Go defaults"`
+	// ClientCAFile is the PEM bundle client certificates are verified against.
+	ClientCAFile string `desc:"PEM bundle client certificates are verified against"`
+	// ClientAuth is one of none, request, require, verify_if_given or require_and_verify.
+	ClientAuth     string        `enum:"none,request,require,verify_if_given,require_and_verify" desc:"Client certificate policy"`
+	ReloadInterval time.Duration `desc:"How often certificate files are checked for changes"`
+}
+
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                   tls.NoClientCert,
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+func (c *TLS) ParsedMinVersion() (uint16, error) {
+	v, ok := tlsVersions[c.MinVersion]
+	if !ok {
+		return 0, fmt.Errorf("unsupported minVersion %q, expected 1.2 or 1.3", c.MinVersion)
+	}
+	return v, nil
+}
+
+func (c *TLS) ParsedCipherSuites() ([]uint16, error) {
+	if len(c.CipherSuites) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, cs := range tls.CipherSuites() {
+		known[cs.Name] = cs.ID
+	}
+	ids := make([]uint16, 0, len(c.CipherSuites))
+	for _, name := range c.CipherSuites {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (c *TLS) ParsedClientAuth() (tls.ClientAuthType, error) {
+	t, ok := clientAuthTypes[strings.ToLower(c.ClientAuth)]
+	if !ok {
+		return tls.NoClientCert, fmt.Errorf("unsupported clientAuth %q", c.ClientAuth)
+	}
+	return t, nil
+}
+
+// Validate checks the TLS settings. Nothing is checked when TLS is disabled.
+func (c *TLS) Validate() error {
+	v := &validator{}
+	c.validate(v, "")
+	return v.err()
+}
+
+func (c *TLS) validate(v *validator, path string) {
+	if !c.Enabled {
+		return
+	}
+	if c.CertFile == "" {
+		v.addf(joinPath(path, "certFile"), "is required when tls is enabled")
+	}
+	if c.KeyFile == "" {
+		v.addf(joinPath(path, "keyFile"), "is required when tls is enabled")
+	}
+	if _, err := c.ParsedMinVersion(); err != nil {
+		v.addf(joinPath(path, "minVersion"), "%v", err)
+	}
+	if _, err := c.ParsedCipherSuites(); err != nil {
+		v.addf(joinPath(path, "cipherSuites"), "%v", err)
+	}
+	auth, err := c.ParsedClientAuth()
+	if err != nil {
+		v.addf(joinPath(path, "clientAuth"), "%v", err)
+	}
+	if (auth == tls.VerifyClientCertIfGiven || auth == tls.RequireAndVerifyClientCert) && c.ClientCAFile == "" {
+		v.addf(joinPath(path, "clientCAFile"), "is required for clientAuth %q", c.ClientAuth)
+	}
+	if c.ReloadInterval < 0 {
+		v.addf(joinPath(path, "reloadInterval"), "must not be negative, got %v", c.ReloadInterval)
+	}
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"slices"
+	"strings"
+)
+
+// TracingExporters are the supported values of Tracing.Exporter.
+var TracingExporters = []string{"otlp", "stdout", "file", "none"}
+
+// Tracing configures OpenTelemetry tracing, see package tracing.
+// W3C trace context is always propagated, even when no spans are exported.
+type Tracing struct {
+	Enabled  bool   `mapstructure:"ENABLED" desc:"Record and export spans"`
+	Exporter string `mapstructure:"EXPORTER" enum:"otlp,stdout,file,none" desc:"Where spans are exported to"`
+	// Endpoint is host:port of an OTLP/HTTP collector or a full URL such as https://collector:4318/v1/traces.
+	Endpoint    string  `mapstructure:"ENDPOINT" desc:"OTLP/HTTP collector as host:port or URL"`
+	Insecure    bool    `mapstructure:"INSECURE" desc:"Use plain HTTP for an OTLP endpoint given as host:port"`
+	File        string  `mapstructure:"FILE" desc:"File spans are appended to by the file exporter"`
+	SampleRatio float64 `mapstructure:"SAMPLE_RATIO" desc:"Share of new traces that are sampled, between 0 and 1. Sampled callers are always followed"`
+	ServiceName string  `mapstructure:"SERVICE_NAME" desc:"service.name of the spans, empty uses APP_NAME"`
+}
+
+func (c *Tracing) validate(v *validator, path string) {
+	if !c.Enabled {
+		return
+	}
+	exporter := strings.ToLower(c.Exporter)
+	if !slices.Contains(TracingExporters, exporter) {
+		v.addf(joinPath(path, "EXPORTER"), "unknown exporter %q, expected one of %s", c.Exporter, strings.Join(TracingExporters, ", "))
+	}
+	if exporter == "otlp" && c.Endpoint == "" {
+		v.addf(joinPath(path, "ENDPOINT"), "is required for the otlp exporter")
+	}
+	if exporter == "file" && c.File == "" {
+		v.addf(joinPath(path, "FILE"), "is required for the file exporter")
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		v.addf(joinPath(path, "SAMPLE_RATIO"), "%v is out of range 0-1", c.SampleRatio)
+	}
+}
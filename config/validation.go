@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// FieldError is a single problem found in the configuration.
+// Path is the key of the offending value as written in the config files, e.g. BIG_CACHE.SHARDS.
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists every problem found in the configuration.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("invalid configuration, %d problem(s):", len(e)))
+	for _, fe := range e {
+		lines = append(lines, "  "+fe.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validator collects field errors instead of stopping at the first one.
+type validator struct {
+	errs ValidationError
+}
+
+func (v *validator) addf(path, format string, args ...any) {
+	v.errs = append(v.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+var logLevels = []string{"debug", "info", "warn", "error", "dpanic", "panic", "fatal"}
+
+// Validate checks the whole configuration and returns a ValidationError listing every problem.
+func (c *Configurations) Validate() error {
+	v := &validator{}
+	if c.AppName == "" {
+		v.addf("APP_NAME", "must not be empty")
+	}
+	c.LogConfig.validate(v, "LOG")
+	c.BigCache.validate(v, "BIG_CACHE")
+	c.Cors.validate(v, "CORS")
+	for _, name := range sortedKeys(c.CorsPolicies) {
+		if policy := c.CorsPolicies[name]; policy != nil {
+			policy.validate(v, joinPath("CORS_POLICIES", name))
+		} else {
+			v.addf(joinPath("CORS_POLICIES", name), "must not be empty")
+		}
+	}
+	c.Hystrix.validate(v, "HYSTRIX")
+	c.AccessLog.validate(v, "ACCESS_LOG")
+	c.Tracing.validate(v, "TRACING")
+	c.RequestID.validate(v, "REQUEST_ID")
+	validateFeatureFlags(v, "FEATURE_FLAGS", c.FeatureFlags)
+	for _, name := range sortedKeys(c.RateLimits) {
+		if policy := c.RateLimits[name]; policy != nil {
+			policy.validate(v, joinPath("RATE_LIMITS", name))
+		} else {
+			v.addf(joinPath("RATE_LIMITS", name), "must not be empty")
+		}
+	}
+	c.Compression.validate(v, "COMPRESSION")
+	c.ConcurrencyLimit.validate(v, "CONCURRENCY_LIMIT")
+	validateRoutes(v, "ROUTES", c.Routes, c.CorsPolicies, c.RateLimits)
+	c.HttpServer.validate(v, "httpServer")
+	c.AdminServer.validate(v, "adminServer")
+	if c.HttpServer != nil && c.AdminServer != nil && c.HttpServer.Port == c.AdminServer.Port &&
+		(c.HttpServer.Host == c.AdminServer.Host || c.HttpServer.Host == "" || c.AdminServer.Host == "") {
+		v.addf("adminServer.port", "conflicts with httpServer.port %d", c.HttpServer.Port)
+	}
+	return v.err()
+}
+
+func (c *Log) validate(v *validator, path string) {
+	if c.Level == "" {
+		return
+	}
+	for _, l := range logLevels {
+		if strings.EqualFold(c.Level, l) {
+			return
+		}
+	}
+	v.addf(joinPath(path, "LEVEL"), "unknown level %q, expected one of %s", c.Level, strings.Join(logLevels, ", "))
+}
+
+func (c *BigCacheConfig) validate(v *validator, path string) {
+	if c.TTL < 0 {
+		v.addf(joinPath(path, "TTL_SECS"), "must not be negative, got %d", c.TTL)
+	}
+	if c.Shards <= 0 || c.Shards&(c.Shards-1) != 0 {
+		v.addf(joinPath(path, "SHARDS"), "must be a power of two, got %d", c.Shards)
+	}
+	if c.MaxEntrySize < 0 {
+		v.addf(joinPath(path, "MAX_ENTRY_SIZE"), "must not be negative, got %d", c.MaxEntrySize)
+	}
+	if c.HardMaxCacheSize < 0 {
+		v.addf(joinPath(path, "HARD_MAX_CACHE_SIZE"), "must not be negative, got %d", c.HardMaxCacheSize)
+	}
+	// MaxEntrySize is in bytes while HardMaxCacheSize is in MB, 0 means unlimited.
+	if c.HardMaxCacheSize > 0 && c.MaxEntrySize > c.HardMaxCacheSize*1024*1024 {
+		v.addf(joinPath(path, "MAX_ENTRY_SIZE"), "%d bytes exceeds HARD_MAX_CACHE_SIZE of %d MB",
+			c.MaxEntrySize, c.HardMaxCacheSize)
+	}
+}
+
+func validMethod(m string) bool {
+	switch strings.TrimSpace(m) {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
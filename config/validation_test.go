@@ -0,0 +1,107 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validServer(port int) *HttpServer {
+	return &HttpServer{
+		Port:              port,
+		ReadTimeout:       5 * time.Second,
+		ReadHeaderTimeout: 2 * time.Second,
+		WriteTimeout:      15 * time.Second,
+		IdleTimeout:       10 * time.Second,
+	}
+}
+
+func validConfigurations() Configurations {
+	return Configurations{
+		AppName:     "backend",
+		LogConfig:   Log{Level: "info"},
+		BigCache:    BigCacheConfig{TTL: 900, Shards: 16, MaxEntrySize: 20, HardMaxCacheSize: 200},
+		Cors:        Cors{Origins: []string{"https://reviews.swiggy.com"}, Methods: []string{"POST", "OPTIONS"}},
+		HttpServer:  validServer(8080),
+		AdminServer: validServer(9090),
+	}
+}
+
+func TestConfigurations_Validate(t *testing.T) {
+	cfg := validConfigurations()
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestConfigurations_ValidateAggregatesErrors(t *testing.T) {
+	cfg := validConfigurations()
+	cfg.LogConfig.Level = "verbose"
+	cfg.BigCache.Shards = 10
+	cfg.BigCache.TTL = -1
+	cfg.BigCache.HardMaxCacheSize = 1
+	cfg.BigCache.MaxEntrySize = 2 * 1024 * 1024
+	cfg.Cors.Origins = nil
+	cfg.HttpServer.ReadTimeout = 0
+	cfg.AdminServer = nil
+
+	err := cfg.Validate()
+	require.Error(t, err)
+
+	var verr ValidationError
+	require.True(t, errors.As(err, &verr))
+	var paths []string
+	for _, fe := range verr {
+		paths = append(paths, fe.Path)
+	}
+	assert.ElementsMatch(t, []string{
+		"LOG.LEVEL",
+		"BIG_CACHE.TTL_SECS",
+		"BIG_CACHE.SHARDS",
+		"BIG_CACHE.MAX_ENTRY_SIZE",
+		"CORS.ORIGINS",
+		"httpServer.readTimeout",
+		"adminServer",
+	}, paths)
+}
+
+func TestConfigurations_ValidateRoutes(t *testing.T) {
+	cfg := validConfigurations()
+	cfg.Routes = map[string]Route{
+		"a": {Path: "/a", Methods: []string{"GET"}},
+		"b": {Path: "/a", Methods: []string{"FETCH"}, Timeout: -time.Second},
+		"c": {Path: "c", RateLimit: "missing", ETag: "md5", Middlewares: []string{""}},
+	}
+	cfg.RateLimits = map[string]*RateLimit{
+		"bad": {Algorithm: "leaky_bucket", Limit: 0, Window: time.Second, Key: "userId"},
+		"ok":  {Limit: 10, Window: time.Second},
+	}
+
+	var verr ValidationError
+	require.ErrorAs(t, cfg.Validate(), &verr)
+	paths := make([]string, 0, len(verr))
+	for _, fe := range verr {
+		paths = append(paths, fe.Path)
+	}
+	assert.Equal(t, []string{
+		"RATE_LIMITS.bad.ALGORITHM", "RATE_LIMITS.bad.LIMIT", "RATE_LIMITS.bad.KEY",
+		"ROUTES.b.PATH", "ROUTES.b.METHODS[0]", "ROUTES.b.TIMEOUT",
+		"ROUTES.c.PATH", "ROUTES.c.RATE_LIMIT", "ROUTES.c.ETAG", "ROUTES.c.MIDDLEWARES[0]",
+	}, paths)
+}
+
+func TestCors_Validate(t *testing.T) {
+	cfg := validConfigurations()
+	cfg.Cors.Origins = []string{"https://*.swiggy.com", "regex:https://(", "https://a.*.com", "reviews.swiggy.com", "*"}
+	cfg.Cors.AllowCredentials = true
+	cfg.Routes = map[string]Route{"a": {Path: "/a", CorsPolicy: "partners"}}
+
+	var verr ValidationError
+	require.ErrorAs(t, cfg.Validate(), &verr)
+	paths := make([]string, 0, len(verr))
+	for _, fe := range verr {
+		paths = append(paths, fe.Path)
+	}
+	assert.Equal(t, []string{"CORS.ORIGINS[1]", "CORS.ORIGINS[2]", "CORS.ORIGINS[3]", "CORS.ORIGINS[4]", "ROUTES.a.CORS_POLICY"}, paths)
+}
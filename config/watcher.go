@@ -0,0 +1,105 @@
+package config
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// Watcher keeps the live configuration and reloads it when one of the config files changes.
+//
+// A reload goes through the same layers and validation as the initial load.
+// A reload that fails is rejected and the previous configuration stays in effect.
+// Configuration keeps the snapshot taken at startup, use Current for the live one.
+type Watcher struct {
+	loader      *Loader
+	current     atomic.Pointer[Snapshot]
+	mu          sync.Mutex // serialises reloads and subscriber registration
+	subscribers []func(old, new *Configurations)
+}
+
+// Snapshot is one loaded configuration.
+type Snapshot struct {
+	Config   *Configurations
+	LoadedAt time.Time
+	// SecretKeys are the keys whose value was resolved from a secret reference.
+	SecretKeys map[string]bool
+}
+
+// Redacted returns the configuration with all secrets hidden, see Redacted.
+func (s *Snapshot) Redacted() map[string]any {
+	return Redacted(s.Config, s.SecretKeys)
+}
+
+func (s *Snapshot) Hash() string {
+	return Hash(s.Config, s.SecretKeys)
+}
+
+// NewWatcher starts from initial, which has to be the result of the last Load of loader.
+func NewWatcher(loader *Loader, initial Configurations) *Watcher {
+	w := &Watcher{loader: loader}
+	w.current.Store(&Snapshot{Config: &initial, LoadedAt: time.Now(), SecretKeys: loader.SecretKeys()})
+	return w
+}
+
+// Current returns the configuration in effect. The returned value must not be modified.
+func (w *Watcher) Current() *Configurations {
+	return w.current.Load().Config
+}
+
+// Snapshot returns the configuration in effect together with when it was loaded.
+func (w *Watcher) Snapshot() *Snapshot {
+	return w.current.Load()
+}
+
+// Subscribe registers fn to be called whenever the section selected by section changes.
+// fn receives the old and new value of the same reload; calls are never concurrent.
+func Subscribe[T any](w *Watcher, section func(*Configurations) T, fn func(old, new T)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, func(old, new *Configurations) {
+		o, n := section(old), section(new)
+		if !reflect.DeepEqual(o, n) {
+			fn(o, n)
+		}
+	})
+}
+
+// Reload loads and validates all layers and, when that succeeds, swaps the
+// live configuration and notifies subscribers of the sections that changed.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	cfg, err := w.loader.Load()
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	old := w.current.Swap(&Snapshot{Config: &cfg, LoadedAt: time.Now(), SecretKeys: w.loader.SecretKeys()})
+	for _, notify := range w.subscribers {
+		notify(old.Config, &cfg)
+	}
+	return nil
+}
+
+// Watch uses viper's file watching on every file of the last load and reloads on change.
+// onReload is called after every attempt with the outcome, a nil error means the new
+// configuration is in effect. Layer files created after startup are not picked up.
+func (w *Watcher) Watch(onReload func(err error)) {
+	for _, file := range w.loader.Files() {
+		v := viper.New()
+		v.SetConfigFile(file)
+		v.OnConfigChange(func(fsnotify.Event) {
+			onReload(w.Reload())
+		})
+		v.WatchConfig()
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const watcherTestConfig = `
+APP_NAME: "backend"
+LOG:
+  LEVEL: %s
+BIG_CACHE:
+  TTL_SECS: 900
+  SHARDS: %d
+CORS:
+  ORIGINS: https://reviews.swiggy.com
+httpServer:
+  port: 8080
+  readTimeout: 5s
+  readHeaderTimeout: 2s
+  writeTimeout: 15s
+  idleTimeout: 10s
+adminServer:
+  port: 9090
+  readTimeout: 5s
+  readHeaderTimeout: 2s
+  writeTimeout: 15s
+  idleTimeout: 10s
+`
+
+func TestWatcher_Reload(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(EnvEnvironment, "none")
+	writeFile(t, dir, "default.yaml", fmt.Sprintf(watcherTestConfig, "info", 16))
+
+	loader := NewLoader(Options{Path: dir})
+	cfg, err := loader.Load()
+	require.NoError(t, err)
+	w := NewWatcher(loader, cfg)
+
+	var levels [][2]string
+	Subscribe(w, func(c *Configurations) Log { return c.LogConfig }, func(old, new Log) {
+		levels = append(levels, [2]string{old.Level, new.Level})
+	})
+	cacheChanges := 0
+	Subscribe(w, func(c *Configurations) BigCacheConfig { return c.BigCache }, func(_, _ BigCacheConfig) {
+		cacheChanges++
+	})
+
+	writeFile(t, dir, "default.yaml", fmt.Sprintf(watcherTestConfig, "debug", 16))
+	require.NoError(t, w.Reload())
+	assert.Equal(t, [][2]string{{"info", "debug"}}, levels)
+	assert.Equal(t, 0, cacheChanges)
+	assert.Equal(t, "debug", w.Current().LogConfig.Level)
+
+	// An invalid file is rejected and the previous configuration stays in effect.
+	writeFile(t, dir, "default.yaml", fmt.Sprintf(watcherTestConfig, "warn", 10))
+	assert.Error(t, w.Reload())
+	assert.Len(t, levels, 1)
+	assert.Equal(t, "debug", w.Current().LogConfig.Level)
+}
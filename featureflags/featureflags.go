@@ -0,0 +1,154 @@
+// Package featureflags evaluates the feature flags of the FEATURE_FLAGS config section.
+//
+// Flags are evaluated against the request context: a flag is on for the customers, devices
+// and sources it targets and for a deterministic share of everyone else. The share is
+// bucketed by hashing the flag name with the customer id (or the BUCKET_BY value), so a
+// customer keeps its variant while the rollout percentage only grows.
+package featureflags
+
+import (
+	"backend/config"
+	"backend/httpserver"
+	"context"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Variants of a flag.
+const (
+	VariantOn  = "on"
+	VariantOff = "off"
+)
+
+// Reasons for the variant of an evaluation.
+const (
+	ReasonUnknown  = "unknown"  // the flag is not configured
+	ReasonDisabled = "disabled" // ENABLED is false
+	ReasonTargeted = "targeted" // the customer, device or source is targeted
+	ReasonRollout  = "rollout"  // the request fell into the rollout percentage, or not
+)
+
+// Evaluation is the outcome of evaluating a flag for one request.
+type Evaluation struct {
+	Flag    string
+	Variant string
+	Reason  string
+}
+
+func (e Evaluation) On() bool {
+	return e.Variant == VariantOn
+}
+
+var evaluations = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "foundation_gateway_service",
+		Name:      "feature_flag_evaluations_total",
+		Help:      "Feature flag evaluations per flag and variant.",
+	},
+	[]string{"flag", "variant"},
+)
+
+func init() {
+	prometheus.MustRegister(evaluations)
+}
+
+// Evaluator evaluates a set of flags which can be swapped at any time.
+type Evaluator struct {
+	flags atomic.Pointer[map[string]config.FeatureFlag]
+}
+
+func NewEvaluator(flags map[string]config.FeatureFlag) *Evaluator {
+	e := &Evaluator{}
+	e.SetFlags(flags)
+	return e
+}
+
+// SetFlags replaces all flags, evaluations in flight use either the old or the new set.
+func (e *Evaluator) SetFlags(flags map[string]config.FeatureFlag) {
+	normalized := make(map[string]config.FeatureFlag, len(flags))
+	for name, flag := range flags {
+		normalized[strings.ToLower(name)] = flag
+	}
+	e.flags.Store(&normalized)
+}
+
+// Evaluate returns the variant of the flag name for the request of ctx.
+// Unknown flags are off. Names are case-insensitive like config keys.
+func (e *Evaluator) Evaluate(ctx context.Context, name string) Evaluation {
+	name = strings.ToLower(name)
+	eval := Evaluation{Flag: name, Variant: VariantOff, Reason: ReasonUnknown}
+	if flag, ok := (*e.flags.Load())[name]; ok {
+		eval.Variant, eval.Reason = evaluate(ctx, name, flag)
+	}
+	evaluations.WithLabelValues(eval.Flag, eval.Variant).Inc()
+	return eval
+}
+
+// IsEnabled reports whether the flag name is on for the request of ctx.
+func (e *Evaluator) IsEnabled(ctx context.Context, name string) bool {
+	return e.Evaluate(ctx, name).On()
+}
+
+func evaluate(ctx context.Context, name string, flag config.FeatureFlag) (variant, reason string) {
+	if !flag.Enabled {
+		return VariantOff, ReasonDisabled
+	}
+	if targeted(flag.CustomerIDs, ctxValue(ctx, httpserver.ContextKeyCustomerID)) ||
+		targeted(flag.DeviceIDs, ctxValue(ctx, httpserver.ContextKeyDeviceID)) ||
+		targeted(flag.Sources, ctxValue(ctx, httpserver.ContextKeySource)) {
+		return VariantOn, ReasonTargeted
+	}
+
+	bucketKey := flag.BucketBy
+	if bucketKey == "" {
+		bucketKey = httpserver.ContextKeyCustomerID
+	}
+	if flag.RolloutPercent >= 100 {
+		return VariantOn, ReasonRollout
+	}
+	subject := ctxValue(ctx, bucketKey)
+	if subject == "" || flag.RolloutPercent <= 0 || Bucket(name, subject) >= flag.RolloutPercent {
+		return VariantOff, ReasonRollout
+	}
+	return VariantOn, ReasonRollout
+}
+
+// Bucket maps subject to one of 100 buckets. Every flag buckets independently, so that
+// the same customers are not always the first to get every new feature.
+func Bucket(flag, subject string) int {
+	h := fnv.New32a()
+	h.Write([]byte(flag))
+	h.Write([]byte{0})
+	h.Write([]byte(subject))
+	return int(h.Sum32() % 100)
+}
+
+func targeted(targets []string, value string) bool {
+	return value != "" && slices.Contains(targets, value)
+}
+
+func ctxValue(ctx context.Context, key string) string {
+	value, _ := ctx.Value(key).(string)
+	return value
+}
+
+var defaultEvaluator = NewEvaluator(nil)
+
+// SetFlags replaces the flags used by Evaluate and IsEnabled.
+func SetFlags(flags map[string]config.FeatureFlag) {
+	defaultEvaluator.SetFlags(flags)
+}
+
+// Evaluate evaluates name with the flags of the last SetFlags.
+func Evaluate(ctx context.Context, name string) Evaluation {
+	return defaultEvaluator.Evaluate(ctx, name)
+}
+
+// IsEnabled reports whether name is on for the request of ctx with the flags of the last SetFlags.
+func IsEnabled(ctx context.Context, name string) bool {
+	return defaultEvaluator.IsEnabled(ctx, name)
+}
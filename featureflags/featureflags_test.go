@@ -0,0 +1,55 @@
+package featureflags
+
+import (
+	"backend/config"
+	"backend/httpserver"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func customerCtx(id string) context.Context {
+	return httpserver.AttachToCtx(context.Background(), httpserver.ContextKeyCustomerID, id)
+}
+
+func TestEvaluator_Evaluate(t *testing.T) {
+	e := NewEvaluator(map[string]config.FeatureFlag{
+		"new_provider": {Enabled: true, CustomerIDs: []string{"42"}, Sources: []string{"ios"}},
+		"killed":       {Enabled: false, RolloutPercent: 100},
+		"everyone":     {Enabled: true, RolloutPercent: 100},
+	})
+
+	assert.Equal(t, Evaluation{Flag: "new_provider", Variant: VariantOn, Reason: ReasonTargeted}, e.Evaluate(customerCtx("42"), "new_provider"))
+	assert.Equal(t, Evaluation{Flag: "new_provider", Variant: VariantOff, Reason: ReasonRollout}, e.Evaluate(customerCtx("7"), "new_provider"))
+	ios := httpserver.AttachToCtx(context.Background(), httpserver.ContextKeySource, "ios")
+	assert.True(t, e.IsEnabled(ios, "NEW_PROVIDER"))
+	assert.Equal(t, ReasonDisabled, e.Evaluate(customerCtx("42"), "killed").Reason)
+	assert.True(t, e.IsEnabled(context.Background(), "everyone"))
+	assert.Equal(t, Evaluation{Flag: "missing", Variant: VariantOff, Reason: ReasonUnknown}, e.Evaluate(customerCtx("42"), "missing"))
+}
+
+func TestEvaluator_RolloutIsDeterministic(t *testing.T) {
+	e := NewEvaluator(map[string]config.FeatureFlag{"half": {Enabled: true, RolloutPercent: 50}})
+
+	on := 0
+	for i := 0; i < 1000; i++ {
+		ctx := customerCtx(fmt.Sprint(i))
+		first := e.IsEnabled(ctx, "half")
+		assert.Equal(t, first, e.IsEnabled(ctx, "half"))
+		if first {
+			on++
+		}
+	}
+	assert.InDelta(t, 500, on, 60)
+
+	// Growing the rollout keeps everyone who already had the flag.
+	wider := NewEvaluator(map[string]config.FeatureFlag{"half": {Enabled: true, RolloutPercent: 80}})
+	for i := 0; i < 1000; i++ {
+		ctx := customerCtx(fmt.Sprint(i))
+		if e.IsEnabled(ctx, "half") {
+			assert.True(t, wider.IsEnabled(ctx, "half"))
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"backend/config"
+	"backend/httpserver"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type effectiveConfig struct {
+	Hash     string         `json:"hash"`
+	LoadedAt time.Time      `json:"loadedAt"`
+	Config   map[string]any `json:"config"`
+}
+
+// NewConfigHandler serves the configuration the process is running with, secrets redacted.
+// Operators can compare the hash across pods to check they all loaded the same config.
+func NewConfigHandler(router httpserver.Router, watcher *config.Watcher) {
+	router.AddRoute(httpserver.RouteConfig{
+		Path: "/debug/config",
+		Handler: http.HandlerFunc(func(resp http.ResponseWriter, _ *http.Request) {
+			snapshot := watcher.Snapshot()
+			resp.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(resp).Encode(effectiveConfig{
+				Hash:     snapshot.Hash(),
+				LoadedAt: snapshot.LoadedAt,
+				Config:   snapshot.Redacted(),
+			})
+		}),
+		Methods: []string{http.MethodGet},
+	})
+}
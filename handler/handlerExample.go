@@ -17,26 +17,12 @@ type ContentGetUserListsAPIHandler struct {
 	debugMode bool
 }
 
-func NewLocationAPIHandler(ctx context.Context, router httpserver.Router) {
+// NewLocationAPIHandler registers the location handlers, the ROUTES config section mounts them.
+func NewLocationAPIHandler(ctx context.Context, registry *httpserver.RouteRegistry) {
 	locationAPIHandler := &LocationFeaturesAPIHandler{}
 
-	middlewares := []httpserver.Middleware{}
-
-	wrapper := httpserver.ChainMiddleware(http.HandlerFunc(locationAPIHandler.ServeHTTP), middlewares...)
-	debugWrapper := httpserver.ChainMiddleware(http.HandlerFunc(locationAPIHandler.ServeHTTPWithDebug), middlewares...)
-
-	router.AddRoute(httpserver.RouteConfig{
-		Path:       "/api/v1/location_based_features",
-		Handler:    wrapper,
-		Methods:    []string{http.MethodGet},
-		Instrument: true,
-	})
-	router.AddRoute(httpserver.RouteConfig{
-		Path:       "/api/v1/debug/location_based_features",
-		Handler:    debugWrapper,
-		Methods:    []string{http.MethodGet},
-		Instrument: true,
-	})
+	registry.Handle("location_features", http.HandlerFunc(locationAPIHandler.ServeHTTP))
+	registry.Handle("location_features_debug", http.HandlerFunc(locationAPIHandler.ServeHTTPWithDebug))
 }
 
 func (handler *LocationFeaturesAPIHandler) ServeHTTP(respWriter http.ResponseWriter, req *http.Request) {
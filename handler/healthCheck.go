@@ -5,7 +5,9 @@ import (
 	"net/http"
 )
 
-func NewHealthChecker(router httpserver.Router) {
+// NewHealthChecker registers the liveness route and, when a probe is given,
+// the readiness route which starts failing once the server begins draining.
+func NewHealthChecker(router httpserver.Router, readiness *httpserver.HealthProbe) {
 	router.AddRoute(httpserver.RouteConfig{
 		Path: "/rest/health",
 		Handler: http.HandlerFunc(func(resp http.ResponseWriter, _ *http.Request) {
@@ -14,4 +16,13 @@ func NewHealthChecker(router httpserver.Router) {
 		Methods:    []string{http.MethodGet},
 		Instrument: true,
 	})
+	if readiness == nil {
+		return
+	}
+	router.AddRoute(httpserver.RouteConfig{
+		Path:       "/rest/ready",
+		Handler:    readiness,
+		Methods:    []string{http.MethodGet},
+		Instrument: true,
+	})
 }
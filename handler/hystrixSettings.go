@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"backend/httpserver"
+	"encoding/json"
+	"net/http"
+
+	"github.com/afex/hystrix-go/hystrix"
+)
+
+type hystrixCommandSettings struct {
+	TimeoutMs              int64  `json:"timeout_ms"`
+	MaxConcurrentRequests  int    `json:"max_concurrent_requests"`
+	RequestVolumeThreshold uint64 `json:"request_volume_threshold"`
+	SleepWindowMs          int64  `json:"sleep_window_ms"`
+	ErrorPercentThreshold  int    `json:"error_percent_threshold"`
+}
+
+// NewHystrixSettingsHandler exposes the settings hystrix is actually using for every known command.
+// This includes commands which are not declared in config and run with the hystrix-go defaults.
+func NewHystrixSettingsHandler(router httpserver.Router) {
+	router.AddRoute(httpserver.RouteConfig{
+		Path: "/debug/hystrix",
+		Handler: http.HandlerFunc(func(resp http.ResponseWriter, _ *http.Request) {
+			settings := make(map[string]hystrixCommandSettings)
+			for name, s := range hystrix.GetCircuitSettings() {
+				settings[name] = hystrixCommandSettings{
+					TimeoutMs:              s.Timeout.Milliseconds(),
+					MaxConcurrentRequests:  s.MaxConcurrentRequests,
+					RequestVolumeThreshold: s.RequestVolumeThreshold,
+					SleepWindowMs:          s.SleepWindow.Milliseconds(),
+					ErrorPercentThreshold:  s.ErrorPercentThreshold,
+				}
+			}
+			resp.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(resp).Encode(settings)
+		}),
+		Methods: []string{http.MethodGet},
+	})
+}
@@ -0,0 +1,236 @@
+package httpserver
+
+import (
+	"backend/config"
+	"backend/tracing"
+	"context"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const HTTPHeaderNameForwardedFor = "X-Forwarded-For"
+
+// AccessLogMiddleware writes one entry per request of route to logger. enabled is the
+// per-route setting, nil follows settings().Enabled. ctxKeys lists the request context
+// values added to every entry, see config.Log.CtxKeys.
+//
+// Context values attached by the route middlewares, like the request id, are picked up when
+// the route was mounted through a RouteRegistry, which records the context the handler sees.
+func AccessLogMiddleware(route string, logger *zap.Logger, enabled *bool,
+	settings func() *config.AccessLog, ctxKeys func() []string) Middleware {
+	var compiled atomic.Pointer[accessLogPolicy]
+	policy := func() *accessLogPolicy {
+		cfg := settings()
+		if p := compiled.Load(); p != nil && p.source == cfg {
+			return p
+		}
+		p := newAccessLogPolicy(cfg)
+		compiled.Store(p)
+		return p
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := policy()
+			if !p.enabled(enabled) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			body := &countingReader{ReadCloser: r.Body}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = body
+			}
+			r, captured := withCapturedContext(r)
+			rec := newStatusRecorder(w)
+
+			defer func() {
+				// Log requests that panic past the recovery as well, then let them continue.
+				if v := recover(); v != nil {
+					rec.status = http.StatusInternalServerError
+					defer panic(v)
+				}
+				latency := time.Since(start)
+				status := rec.Status()
+				level, ok := p.level(status, latency)
+				if !ok {
+					return
+				}
+				bytesIn := body.n
+				if r.ContentLength > bytesIn {
+					// The handler did not read the whole body.
+					bytesIn = r.ContentLength
+				}
+				ctx := captured.Context(r.Context())
+				fields := []zap.Field{
+					zap.String("method", r.Method),
+					zap.String("path", route),
+					zap.Int("status", status),
+					zap.Int64("bytesIn", bytesIn),
+					zap.Int64("bytesOut", rec.bytes),
+					zap.Duration("latency", latency),
+					zap.String(ContextKeyReqID, requestID(w, r.WithContext(ctx))),
+					zap.String("clientIp", ClientIP(r, p.proxies)),
+					zap.String("userAgent", r.UserAgent()),
+				}
+				if traceID := tracing.TraceID(ctx); traceID != "" {
+					fields = append(fields, zap.String("traceId", traceID))
+				}
+				for _, key := range ctxKeys() {
+					if key == ContextKeyReqID {
+						continue
+					}
+					if value, ok := ctx.Value(key).(string); ok && value != "" {
+						fields = append(fields, zap.String(key, value))
+					}
+				}
+				if ce := logger.Check(level, "access"); ce != nil {
+					ce.Write(fields...)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+type accessLogPolicy struct {
+	source  *config.AccessLog
+	cfg     config.AccessLog
+	proxies []netip.Prefix
+}
+
+// newAccessLogPolicy prepares cfg, invalid proxies are reported by configuration validation
+// and leave no proxy trusted here.
+func newAccessLogPolicy(cfg *config.AccessLog) *accessLogPolicy {
+	p := &accessLogPolicy{source: cfg}
+	if cfg != nil {
+		p.cfg = *cfg
+		p.proxies, _ = cfg.ParsedTrustedProxies()
+	}
+	return p
+}
+
+func (p *accessLogPolicy) enabled(route *bool) bool {
+	if route != nil {
+		return *route
+	}
+	return p.source != nil && p.cfg.Enabled
+}
+
+// level picks the level of an entry and whether the request is logged at all.
+func (p *accessLogPolicy) level(status int, latency time.Duration) (zapcore.Level, bool) {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return zapcore.ErrorLevel, true
+	case status >= http.StatusBadRequest:
+		return zapcore.WarnLevel, true
+	case p.cfg.SlowThreshold > 0 && latency >= p.cfg.SlowThreshold:
+		return zapcore.WarnLevel, true
+	}
+	return zapcore.InfoLevel, rand.Float64() < p.cfg.SuccessSampleRatio
+}
+
+// ClientIP is the peer address of r unless the peer is one of the trusted proxies. Then
+// X-Forwarded-For is walked from the right, skipping trusted proxies, and the first other
+// address is the client.
+func ClientIP(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !trustedProxy(host, trusted) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values(HTTPHeaderNameForwardedFor), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !trustedProxy(hop, trusted) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func trustedProxy(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.ReadCloser.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+type capturedContextKey struct{}
+
+// capturedContext holds the context the route handler was called with.
+type capturedContext struct {
+	atomic.Pointer[context.Context]
+}
+
+// Context returns the context the route handler was called with, fallback when it is unknown.
+func (c *capturedContext) Context(fallback context.Context) context.Context {
+	if ctx := c.Pointer.Load(); ctx != nil {
+		return *ctx
+	}
+	return fallback
+}
+
+// withCapturedContext gives r a holder for the context of the route handler, or returns the
+// one an outer middleware gave it.
+func withCapturedContext(r *http.Request) (*http.Request, *capturedContext) {
+	if c, ok := r.Context().Value(capturedContextKey{}).(*capturedContext); ok {
+		return r, c
+	}
+	c := &capturedContext{}
+	return r.WithContext(context.WithValue(r.Context(), capturedContextKey{}, c)), c
+}
+
+// handlerContext returns the context the route handler was called with, ctx itself when
+// it was not captured.
+func handlerContext(ctx context.Context) context.Context {
+	if c, ok := ctx.Value(capturedContextKey{}).(*capturedContext); ok {
+		return c.Context(ctx)
+	}
+	return ctx
+}
+
+// captureContext records the context h is called with for the access log and metrics of the request.
+func captureContext(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, ok := r.Context().Value(capturedContextKey{}).(*capturedContext); ok {
+			ctx := r.Context()
+			c.Store(&ctx)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
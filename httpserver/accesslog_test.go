@@ -0,0 +1,71 @@
+package httpserver
+
+import (
+	"backend/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAccessLogMiddleware(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	settings := &config.AccessLog{Enabled: true, SlowThreshold: 50 * time.Millisecond, TrustedProxies: []string{"10.0.0.0/8"}}
+	r := NewRouter(RouterOptions{
+		Logger:    zap.New(core),
+		AccessLog: func() *config.AccessLog { return settings },
+		CtxKeys:   func() []string { return []string{ContextKeyReqID, ContextKeyCustomerID} },
+	}).(*router)
+
+	registry := NewRouteRegistry()
+	registry.Handle("echo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			time.Sleep(60 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+	registry.Handle("quiet", http.NotFoundHandler())
+	registry.StaticMiddleware("request_id", RequestIdMiddleware)
+	registry.StaticMiddleware("customer", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(AttachToCtx(r.Context(), ContextKeyCustomerID, "c-1")))
+		})
+	})
+	off := false
+	require.NoError(t, registry.Mount(r, map[string]config.Route{
+		"echo":  {Path: "/echo/{id}", Middlewares: []string{"request_id", "customer"}},
+		"quiet": {Path: "/quiet", AccessLog: &off},
+	}))
+	serve := func(target string) {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader("ping"))
+		req.RemoteAddr = "10.0.0.5:1234"
+		req.Header.Set(HTTPHeaderNameForwardedFor, "203.0.113.7, 10.0.0.9")
+		req.Header.Set(HTTPHeaderNameRequestID, "req-1")
+		r.Mux().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Successful requests are not sampled, slow ones are logged anyway.
+	serve("/echo/1")
+	serve("/echo/1?slow=1")
+	serve("/quiet")
+
+	require.Equal(t, 1, logs.Len())
+	entry := logs.All()[0]
+	assert.Equal(t, zapcore.WarnLevel, entry.Level)
+	fields := entry.ContextMap()
+	assert.Equal(t, "/echo/{id}", fields["path"])
+	assert.Equal(t, int64(http.StatusCreated), fields["status"])
+	assert.Equal(t, int64(4), fields["bytesIn"])
+	assert.Equal(t, int64(5), fields["bytesOut"])
+	assert.Equal(t, "req-1", fields["requestId"])
+	assert.Equal(t, "c-1", fields["customerId"])
+	assert.Equal(t, "203.0.113.7", fields["clientIp"])
+}
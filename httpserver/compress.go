@@ -0,0 +1,448 @@
+package httpserver
+
+import (
+	"backend/config"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	ErrorCodeUnsupportedEncoding = "unsupported_encoding"
+	ErrorCodeMalformedBody       = "malformed_body"
+
+	HTTPHeaderNameAcceptEncoding  = "Accept-Encoding"
+	HTTPHeaderNameContentEncoding = "Content-Encoding"
+	HTTPHeaderNameContentType     = "Content-Type"
+	HTTPHeaderNameContentLength   = "Content-Length"
+	HTTPHeaderNameCacheControl    = "Cache-Control"
+	HTTPHeaderNameETag            = "ETag"
+)
+
+var compressionRatioHistogram = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: "foundation_gateway_service",
+		Name:      "response_compression_ratio",
+		Help:      "Compressed size of responses relative to their uncompressed size.",
+		Buckets:   []float64{0.05, 0.1, 0.15, 0.2, 0.3, 0.4, 0.5, 0.7, 1},
+	},
+	[]string{"path", "encoding"},
+)
+
+func init() {
+	prometheus.MustRegister(compressionRatioHistogram)
+}
+
+// CompressionMiddleware compresses responses of route as configured by settings(), see
+// config.Compression.
+//
+// The response is held back until MIN_SIZE bytes were written, the handler flushed or
+// returned, then it is sent compressed or as is. Flushes are passed on, so streaming
+// responses keep streaming. Strong ETags become weak ones when the response is compressed.
+func CompressionMiddleware(route string, settings func() *config.Compression) Middleware {
+	var compiled atomic.Pointer[compressionPolicy]
+	policy := func() *compressionPolicy {
+		cfg := settings()
+		if p := compiled.Load(); p != nil && p.source == cfg {
+			return p
+		}
+		p := newCompressionPolicy(cfg)
+		compiled.Store(p)
+		return p
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := policy()
+			if p.source == nil || !p.cfg.Enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if p.cfg.DecompressRequests && !p.decodeBody(w, r) {
+				return
+			}
+
+			w.Header().Add(HTTPHeaderNameVary, HTTPHeaderNameAcceptEncoding)
+			encoding := negotiateEncoding(r.Header.Get(HTTPHeaderNameAcceptEncoding), p.encodings)
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, route: route, encoding: encoding, policy: p}
+			completed := false
+			defer func() {
+				if completed {
+					cw.close()
+				} else {
+					// Leave the response to the panic recovery.
+					cw.abandon()
+				}
+			}()
+			next.ServeHTTP(cw, r)
+			completed = true
+		})
+	}
+}
+
+type compressionPolicy struct {
+	source    *config.Compression
+	cfg       config.Compression
+	encodings []string
+}
+
+func newCompressionPolicy(cfg *config.Compression) *compressionPolicy {
+	p := &compressionPolicy{source: cfg}
+	if cfg != nil {
+		p.cfg = *cfg
+		p.encodings = cfg.ParsedEncodings()
+	}
+	return p
+}
+
+// decodeBody replaces an encoded request body by its decoded content. It answers the
+// request itself and returns false when the body cannot be decoded.
+func (p *compressionPolicy) decodeBody(w http.ResponseWriter, r *http.Request) bool {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get(HTTPHeaderNameContentEncoding)))
+	if encoding == "" || encoding == "identity" {
+		return true
+	}
+	if !slices.Contains(p.encodings, encoding) {
+		// RFC 7694, tell the client which codings it may use instead.
+		w.Header().Set(HTTPHeaderNameAcceptEncoding, strings.Join(p.encodings, ", "))
+		WriteError(w, r, http.StatusUnsupportedMediaType, ErrorBody{
+			Code:    ErrorCodeUnsupportedEncoding,
+			Message: fmt.Sprintf("unsupported Content-Encoding %q", encoding),
+		})
+		return false
+	}
+	body, err := newDecoder(encoding, r.Body)
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, ErrorBody{
+			Code:    ErrorCodeMalformedBody,
+			Message: fmt.Sprintf("request body is not valid %s", encoding),
+		})
+		return false
+	}
+	if p.cfg.MaxRequestSize > 0 {
+		body = http.MaxBytesReader(w, body, int64(p.cfg.MaxRequestSize))
+	}
+	r.Body = body
+	r.ContentLength = -1
+	r.Header.Del(HTTPHeaderNameContentEncoding)
+	r.Header.Del(HTTPHeaderNameContentLength)
+	return true
+}
+
+// negotiateEncoding picks the encoding of offered, in order of preference, the
+// Accept-Encoding header value accepts with the highest quality. Empty means identity.
+func negotiateEncoding(accept string, offered []string) string {
+	if accept == "" {
+		return ""
+	}
+	qualities := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if q, _ = strconv.ParseFloat(v, 64); q < 0 {
+					q = 0
+				}
+			}
+		}
+		if name = strings.ToLower(strings.TrimSpace(name)); name == "*" {
+			wildcard = q
+		} else {
+			qualities[name] = q
+		}
+	}
+	best, bestQ := "", 0.0
+	for _, encoding := range offered {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressWriter compresses a response once it decided that the response is worth it.
+type compressWriter struct {
+	http.ResponseWriter
+	route    string
+	encoding string
+	policy   *compressionPolicy
+
+	code    int
+	buf     []byte
+	decided bool
+	enc     encoder
+	out     countingWriter
+	in      int64
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if code < http.StatusOK && code != http.StatusSwitchingProtocols {
+		// Informational responses like 103 Early Hints go out right away.
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.code != 0 {
+		return
+	}
+	cw.code = code
+	if !cw.compressible() {
+		cw.start(false)
+		return
+	}
+	if n, err := strconv.Atoi(cw.Header().Get(HTTPHeaderNameContentLength)); err == nil && n < cw.policy.cfg.MinSize {
+		cw.start(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.code == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		return cw.write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.policy.cfg.MinSize {
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.code == 0 {
+			cw.WriteHeader(http.StatusOK)
+		}
+		// A flushed response is likely streamed, its size is unknown.
+		if !cw.decided && cw.start(true) != nil {
+			return
+		}
+	}
+	if cw.enc != nil && cw.enc.Flush() != nil {
+		return
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// compressible reports from the headers whether the response may be compressed.
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	switch {
+	case cw.code == http.StatusNoContent || cw.code == http.StatusNotModified ||
+		cw.code == http.StatusPartialContent || cw.code == http.StatusSwitchingProtocols:
+		return false
+	case h.Get(HTTPHeaderNameContentEncoding) != "":
+		return false
+	case strings.Contains(strings.ToLower(h.Get(HTTPHeaderNameCacheControl)), "no-transform"):
+		return false
+	}
+	contentType := h.Get(HTTPHeaderNameContentType)
+	return contentType == "" || !cw.policy.cfg.SkipsContentType(contentType)
+}
+
+// start sends the headers and the held back body, compressed when compress is set and the
+// response turns out to be compressible.
+func (cw *compressWriter) start(compress bool) error {
+	cw.decided = true
+	h := cw.Header()
+	if _, ok := h[HTTPHeaderNameContentType]; !ok && len(cw.buf) > 0 {
+		// Sniff like net/http would, it could not once the body is compressed.
+		h.Set(HTTPHeaderNameContentType, http.DetectContentType(cw.buf))
+	}
+	if compress && h.Get(HTTPHeaderNameContentType) != "" && cw.compressible() {
+		h.Del(HTTPHeaderNameContentLength)
+		h.Set(HTTPHeaderNameContentEncoding, cw.encoding)
+		if etag := h.Get(HTTPHeaderNameETag); strings.HasPrefix(etag, `"`) {
+			// The compressed representation is not byte-identical to the one the tag was made for.
+			h.Set(HTTPHeaderNameETag, "W/"+etag)
+		}
+		cw.out.w = cw.ResponseWriter
+		cw.enc = getEncoder(cw.encoding, cw.policy.cfg.Level, &cw.out)
+	}
+	cw.ResponseWriter.WriteHeader(cw.code)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.write(buf)
+	return err
+}
+
+func (cw *compressWriter) write(b []byte) (int, error) {
+	if cw.enc == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.in += int64(len(b))
+	return cw.enc.Write(b)
+}
+
+// close sends what is still held back and finishes the compressed stream.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.code == 0 {
+			// The handler wrote nothing, leave the defaults to net/http.
+			return
+		}
+		cw.start(len(cw.buf) >= cw.policy.cfg.MinSize)
+	}
+	if cw.enc == nil {
+		return
+	}
+	if err := cw.enc.Close(); err == nil && cw.in > 0 {
+		compressionRatioHistogram.WithLabelValues(cw.route, cw.encoding).Observe(float64(cw.out.n) / float64(cw.in))
+	}
+	putEncoder(cw.encoding, cw.policy.cfg.Level, cw.enc)
+	cw.enc = nil
+}
+
+// abandon drops the held back response and the encoder without writing anything more.
+func (cw *compressWriter) abandon() {
+	cw.buf = nil
+	if cw.enc != nil {
+		putEncoder(cw.encoding, cw.policy.cfg.Level, cw.enc)
+		cw.enc = nil
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// encoder is implemented by the writers of all supported encodings.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoderPools holds a *sync.Pool of encoders per encoding and level, encoders keep large
+// buffers which are worth reusing.
+var encoderPools sync.Map
+
+func getEncoder(encoding, level string, w io.Writer) encoder {
+	pool, _ := encoderPools.LoadOrStore(encoding+"/"+level, &sync.Pool{})
+	if enc, ok := pool.(*sync.Pool).Get().(encoder); ok {
+		enc.Reset(w)
+		return enc
+	}
+	return newEncoder(encoding, level, w)
+}
+
+func putEncoder(encoding, level string, enc encoder) {
+	enc.Reset(io.Discard)
+	pool, _ := encoderPools.LoadOrStore(encoding+"/"+level, &sync.Pool{})
+	pool.(*sync.Pool).Put(enc)
+}
+
+func newEncoder(encoding, level string, w io.Writer) encoder {
+	switch encoding {
+	case config.EncodingBrotli:
+		quality := brotli.DefaultCompression
+		switch level {
+		case "fastest":
+			quality = brotli.BestSpeed
+		case "best":
+			quality = brotli.BestCompression
+		}
+		return brotli.NewWriterLevel(w, quality)
+	case config.EncodingZstd:
+		speed := zstd.SpeedDefault
+		switch level {
+		case "fastest":
+			speed = zstd.SpeedFastest
+		case "best":
+			speed = zstd.SpeedBestCompression
+		}
+		// Browsers only decode windows of up to 8MB, RFC 8878.
+		enc, _ := zstd.NewWriter(w, zstd.WithEncoderLevel(speed), zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(8<<20))
+		return enc
+	}
+	gzipLevel := gzip.DefaultCompression
+	switch level {
+	case "fastest":
+		gzipLevel = gzip.BestSpeed
+	case "best":
+		gzipLevel = gzip.BestCompression
+	}
+	enc, _ := gzip.NewWriterLevel(w, gzipLevel)
+	return enc
+}
+
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	var err error
+	for _, c := range b.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// newDecoder returns body decoded from encoding, gzip headers are checked right away.
+func newDecoder(encoding string, body io.ReadCloser) (io.ReadCloser, error) {
+	switch encoding {
+	case config.EncodingBrotli:
+		return &decodedBody{Reader: brotli.NewReader(body), closers: []io.Closer{body}}, nil
+	case config.EncodingZstd:
+		dec, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return &decodedBody{Reader: dec, closers: []io.Closer{closerFunc(dec.Close), body}}, nil
+	}
+	dec, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	return &decodedBody{Reader: dec, closers: []io.Closer{dec, body}}, nil
+}
+
+type closerFunc func()
+
+func (f closerFunc) Close() error {
+	f()
+	return nil
+}
@@ -0,0 +1,181 @@
+package httpserver
+
+import (
+	"backend/config"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	offered := []string{"br", "zstd", "gzip"}
+	for accept, want := range map[string]string{
+		"":                         "",
+		"identity":                 "",
+		"gzip, deflate":            "gzip",
+		"gzip, br":                 "br",
+		"gzip;q=1, br;q=0.5":       "gzip",
+		"GZIP;level=1;q=0.8, zstd": "zstd",
+		"*":                        "br",
+		"*, br;q=0":                "zstd",
+		"gzip;q=0":                 "",
+	} {
+		assert.Equal(t, want, negotiateEncoding(accept, offered), accept)
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	cfg := &config.Compression{Enabled: true, MinSize: 100, SkipContentTypes: []string{"image/png", "video/"}}
+	body := strings.Repeat(`{"feature":"location"}`, 50)
+	serve := func(accept string, h http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HTTPHeaderNameAcceptEncoding, accept)
+		rec := httptest.NewRecorder()
+		CompressionMiddleware("/compressed", func() *config.Compression { return cfg })(h).ServeHTTP(rec, req)
+		return rec
+	}
+	large := func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(HTTPHeaderNameETag, `"v1"`)
+		w.Header().Set(HTTPHeaderNameContentLength, "1100")
+		io.WriteString(w, body[:550])
+		io.WriteString(w, body[550:])
+	}
+
+	decoders := map[string]func(io.Reader) io.Reader{
+		"gzip": func(r io.Reader) io.Reader { zr, err := gzip.NewReader(r); require.NoError(t, err); return zr },
+		"br":   func(r io.Reader) io.Reader { return brotli.NewReader(r) },
+		"zstd": func(r io.Reader) io.Reader { zr, err := zstd.NewReader(r); require.NoError(t, err); return zr },
+	}
+	for encoding, decode := range decoders {
+		rec := serve(encoding, large)
+		require.Equal(t, encoding, rec.Header().Get(HTTPHeaderNameContentEncoding))
+		assert.Equal(t, HTTPHeaderNameAcceptEncoding, rec.Header().Get(HTTPHeaderNameVary))
+		assert.Empty(t, rec.Header().Get(HTTPHeaderNameContentLength))
+		assert.Equal(t, `W/"v1"`, rec.Header().Get(HTTPHeaderNameETag))
+		assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get(HTTPHeaderNameContentType))
+		assert.Less(t, rec.Body.Len(), len(body))
+		decoded, err := io.ReadAll(decode(rec.Body))
+		require.NoError(t, err)
+		assert.Equal(t, body, string(decoded))
+	}
+
+	// Small, skipped, already encoded and unaccepted responses are sent as is.
+	rec := serve("gzip", func(w http.ResponseWriter, _ *http.Request) { io.WriteString(w, "small") })
+	assert.Empty(t, rec.Header().Get(HTTPHeaderNameContentEncoding))
+	assert.Equal(t, "small", rec.Body.String())
+	rec = serve("gzip", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(HTTPHeaderNameContentType, "image/png")
+		io.WriteString(w, body)
+	})
+	assert.Empty(t, rec.Header().Get(HTTPHeaderNameContentEncoding))
+	rec = serve("gzip", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(HTTPHeaderNameContentEncoding, "br")
+		io.WriteString(w, body)
+	})
+	assert.Equal(t, "br", rec.Header().Get(HTTPHeaderNameContentEncoding))
+	assert.Equal(t, body, rec.Body.String())
+	rec = serve("deflate", large)
+	assert.Empty(t, rec.Header().Get(HTTPHeaderNameContentEncoding))
+	assert.Equal(t, HTTPHeaderNameAcceptEncoding, rec.Header().Get(HTTPHeaderNameVary))
+	assert.Equal(t, body, rec.Body.String())
+
+	cfg = &config.Compression{}
+	rec = serve("gzip", large)
+	assert.Empty(t, rec.Header().Get(HTTPHeaderNameVary))
+	assert.Equal(t, body, rec.Body.String())
+}
+
+func TestCompressionMiddlewareStreams(t *testing.T) {
+	cfg := &config.Compression{Enabled: true, MinSize: 1024}
+	flushed := make(chan struct{})
+	srv := httptest.NewServer(CompressionMiddleware("/stream", func() *config.Compression { return cfg })(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set(HTTPHeaderNameContentType, "text/event-stream")
+			io.WriteString(w, "data: 1\n\n")
+			w.(http.Flusher).Flush()
+			<-flushed
+			io.WriteString(w, "data: 2\n\n")
+		})))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set(HTTPHeaderNameAcceptEncoding, "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "gzip", resp.Header.Get(HTTPHeaderNameContentEncoding))
+
+	// The first event arrives before the handler returns.
+	zr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	first := make([]byte, len("data: 1\n\n"))
+	_, err = io.ReadFull(zr, first)
+	require.NoError(t, err)
+	assert.Equal(t, "data: 1\n\n", string(first))
+	close(flushed)
+	rest, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, "data: 2\n\n", string(rest))
+}
+
+func TestCompressionMiddlewareDecompressesRequests(t *testing.T) {
+	cfg := &config.Compression{Enabled: true, Encodings: []string{"gzip"}, DecompressRequests: true, MaxRequestSize: 1000}
+	var got string
+	var readErr error
+	handler := CompressionMiddleware("/upload", func() *config.Compression { return cfg })(
+		http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			b, err := io.ReadAll(r.Body)
+			got, readErr = string(b), err
+		}))
+	post := func(encoding string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(body))
+		req.Header.Set(HTTPHeaderNameContentEncoding, encoding)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	gzipped := func(s string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		io.WriteString(zw, s)
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	assert.Equal(t, http.StatusOK, post("gzip", gzipped("hello")).Code)
+	assert.Equal(t, "hello", got)
+
+	rec := post("br", []byte("hello"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get(HTTPHeaderNameAcceptEncoding))
+	assert.Equal(t, http.StatusBadRequest, post("gzip", []byte("hello")).Code)
+
+	post("gzip", gzipped(strings.Repeat("a", 2000)))
+	var maxErr *http.MaxBytesError
+	assert.ErrorAs(t, readErr, &maxErr)
+}
+
+func TestCompressionMiddlewarePanic(t *testing.T) {
+	cfg := &config.Compression{Enabled: true, MinSize: 1 << 20}
+	handler := RecoveryMiddleware("/boom", zap.NewNop(), nil)(CompressionMiddleware("/boom", func() *config.Compression { return cfg })(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			io.WriteString(w, "partial")
+			panic("boom")
+		})))
+	req := httptest.NewRequest(http.MethodGet, "/boom", nil)
+	req.Header.Set(HTTPHeaderNameAcceptEncoding, "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "partial")
+}
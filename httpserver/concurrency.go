@@ -0,0 +1,186 @@
+package httpserver
+
+import (
+	"backend/config"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const ErrorCodeOverloaded = "overloaded"
+
+var (
+	concurrencyInFlightGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "foundation_gateway_service",
+			Name:      "concurrency_in_flight",
+			Help:      "Requests currently admitted by a concurrency limiter.",
+		},
+		[]string{"limiter"},
+	)
+	concurrencyLimitGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "foundation_gateway_service",
+			Name:      "concurrency_limit",
+			Help:      "Current adaptive limit of a concurrency limiter.",
+		},
+		[]string{"limiter"},
+	)
+	concurrencyShedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "foundation_gateway_service",
+			Name:      "concurrency_shed_total",
+			Help:      "Requests rejected with 503 by a concurrency limiter.",
+		},
+		[]string{"limiter", "priority"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(concurrencyInFlightGauge, concurrencyLimitGauge, concurrencyShedCounter)
+}
+
+// LatencyObserver is told the latency and status of every request a PathInstrumentor instruments.
+type LatencyObserver interface {
+	ObserveLatency(latency time.Duration, status int)
+}
+
+// ConcurrencyLimiter sheds requests beyond an adaptive limit, see config.ConcurrencyLimit.
+// The limit is adjusted by the latencies passed to ObserveLatency, usually by the
+// PathInstrumentor of the routes it guards.
+type ConcurrencyLimiter struct {
+	name     string
+	settings func() *config.ConcurrencyLimit
+	now      func() time.Time
+
+	mu           sync.Mutex
+	source       *config.ConcurrencyLimit
+	limit        float64
+	inFlight     int
+	lastDecrease time.Time
+}
+
+// NewConcurrencyLimiter returns a limiter reported as name in metrics. A nil or disabled
+// limit from settings admits every request.
+func NewConcurrencyLimiter(name string, settings func() *config.ConcurrencyLimit) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{name: name, settings: settings, now: time.Now}
+}
+
+// Middleware admits requests while the limiter has capacity and answers 503 otherwise.
+func (l *ConcurrencyLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := l.settings()
+		if cfg == nil || !cfg.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		priority := strings.EqualFold(r.Header.Get(cfg.ParsedPriorityHeader()), "high")
+		if !l.acquire(cfg, priority) {
+			label := "normal"
+			if priority {
+				label = "high"
+			}
+			concurrencyShedCounter.WithLabelValues(l.name, label).Inc()
+			w.Header().Set(HTTPHeaderNameRetryAfter, "1")
+			WriteError(w, r, http.StatusServiceUnavailable, ErrorBody{
+				Code:    ErrorCodeOverloaded,
+				Message: "server is overloaded, retry later",
+			})
+			return
+		}
+		defer l.release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acquire takes a slot for a request. Normal requests may only use the share of the limit
+// which is not reserved for priority requests.
+func (l *ConcurrencyLimiter) acquire(cfg *config.ConcurrencyLimit, priority bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.source != cfg {
+		l.reconfigure(cfg)
+	}
+	capacity := l.limit
+	if !priority {
+		capacity *= 1 - cfg.PriorityReserve
+	}
+	if float64(l.inFlight) >= capacity {
+		return false
+	}
+	l.inFlight++
+	concurrencyInFlightGauge.WithLabelValues(l.name).Set(float64(l.inFlight))
+	return true
+}
+
+func (l *ConcurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	concurrencyInFlightGauge.WithLabelValues(l.name).Set(float64(l.inFlight))
+}
+
+// reconfigure starts at the initial limit, after a reload the adapted limit is kept
+// within the new bounds. It is called with mu held.
+func (l *ConcurrencyLimiter) reconfigure(cfg *config.ConcurrencyLimit) {
+	if l.source == nil {
+		l.limit = float64(cfg.InitialLimit)
+	}
+	l.source = cfg
+	l.limit = math.Max(float64(cfg.MinLimit), math.Min(float64(cfg.MaxLimit), l.limit))
+	concurrencyLimitGauge.WithLabelValues(l.name).Set(l.limit)
+}
+
+// ObserveLatency adapts the limit to a finished request: additive increase while requests
+// are fast and the limit is at least half used, multiplicative decrease when they are slow.
+func (l *ConcurrencyLimiter) ObserveLatency(latency time.Duration, _ int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cfg := l.source
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+	switch now := l.now(); {
+	case latency > cfg.LatencyTarget:
+		// One slow burst shrinks the limit once rather than once per request in it.
+		if now.Sub(l.lastDecrease) < cfg.LatencyTarget {
+			return
+		}
+		l.lastDecrease = now
+		l.limit = math.Max(float64(cfg.MinLimit), l.limit*cfg.BackoffRatio)
+	case float64(l.inFlight)*2 >= l.limit:
+		l.limit = math.Min(float64(cfg.MaxLimit), l.limit+1/l.limit)
+	default:
+		return
+	}
+	concurrencyLimitGauge.WithLabelValues(l.name).Set(l.limit)
+}
+
+// Limit returns the current limit, 0 before the first request.
+func (l *ConcurrencyLimiter) Limit() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// observeLatency reports the latency and status of every request to h to observers.
+func observeLatency(h http.Handler, observers ...LatencyObserver) http.Handler {
+	if len(observers) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newStatusRecorder(w)
+		defer func() {
+			latency := time.Since(start)
+			for _, o := range observers {
+				o.ObserveLatency(latency, rec.Status())
+			}
+		}()
+		h.ServeHTTP(rec, r)
+	})
+}
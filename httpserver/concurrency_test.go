@@ -0,0 +1,103 @@
+package httpserver
+
+import (
+	"backend/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyLimiterSheds(t *testing.T) {
+	cfg := &config.ConcurrencyLimit{
+		Enabled: true, InitialLimit: 2, MinLimit: 1, MaxLimit: 4,
+		LatencyTarget: time.Second, BackoffRatio: 0.5, PriorityReserve: 0.5,
+	}
+	l := NewConcurrencyLimiter("test_shed", func() *config.ConcurrencyLimit { return cfg })
+
+	entered, block := make(chan struct{}), make(chan struct{})
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		entered <- struct{}{}
+		<-block
+	}))
+	serve := func(priority string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if priority != "" {
+			req.Header.Set(config.DefaultPriorityHeader, priority)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	shedNormal := testutil.ToFloat64(concurrencyShedCounter.WithLabelValues("test_shed", "normal"))
+	shedHigh := testutil.ToFloat64(concurrencyShedCounter.WithLabelValues("test_shed", "high"))
+	done := make(chan *httptest.ResponseRecorder, 2)
+	go func() { done <- serve("") }()
+	<-entered
+
+	// Half of the limit of 2 is reserved for priority requests.
+	rec := serve("low")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get(HTTPHeaderNameRetryAfter))
+	assert.Contains(t, rec.Body.String(), `"code":"overloaded"`)
+	assert.Equal(t, shedNormal+1, testutil.ToFloat64(concurrencyShedCounter.WithLabelValues("test_shed", "normal")))
+
+	go func() { done <- serve("HIGH") }()
+	<-entered
+	assert.Equal(t, 2.0, testutil.ToFloat64(concurrencyInFlightGauge.WithLabelValues("test_shed")))
+	assert.Equal(t, http.StatusServiceUnavailable, serve("high").Code)
+	assert.Equal(t, shedHigh+1, testutil.ToFloat64(concurrencyShedCounter.WithLabelValues("test_shed", "high")))
+
+	close(block)
+	assert.Equal(t, http.StatusOK, (<-done).Code)
+	assert.Equal(t, http.StatusOK, (<-done).Code)
+	assert.Equal(t, 0.0, testutil.ToFloat64(concurrencyInFlightGauge.WithLabelValues("test_shed")))
+
+	// Disabling the limit admits everything.
+	cfg = &config.ConcurrencyLimit{}
+	handler = l.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	assert.Equal(t, http.StatusOK, serve("").Code)
+}
+
+func TestConcurrencyLimiterAdapts(t *testing.T) {
+	cfg := &config.ConcurrencyLimit{
+		Enabled: true, InitialLimit: 10, MinLimit: 4, MaxLimit: 11,
+		LatencyTarget: 100 * time.Millisecond, BackoffRatio: 0.5,
+	}
+	l := NewConcurrencyLimiter("test_adapt", func() *config.ConcurrencyLimit { return cfg })
+	now := time.Unix(1000, 0)
+	l.now = func() time.Time { return now }
+	require.True(t, l.acquire(cfg, false))
+	assert.Equal(t, 10.0, l.Limit())
+
+	// An idle limiter does not grow.
+	l.ObserveLatency(time.Millisecond, http.StatusOK)
+	assert.Equal(t, 10.0, l.Limit())
+
+	for i := 0; i < 5; i++ {
+		require.True(t, l.acquire(cfg, false))
+	}
+	l.ObserveLatency(time.Millisecond, http.StatusOK)
+	assert.InDelta(t, 10.1, l.Limit(), 1e-9)
+
+	// Slow requests halve the limit once per latency target, down to the minimum.
+	l.ObserveLatency(time.Second, http.StatusOK)
+	l.ObserveLatency(time.Second, http.StatusOK)
+	assert.InDelta(t, 5.05, l.Limit(), 1e-9)
+	now = now.Add(100 * time.Millisecond)
+	l.ObserveLatency(time.Second, http.StatusOK)
+	assert.Equal(t, 4.0, l.Limit())
+	assert.Equal(t, 4.0, testutil.ToFloat64(concurrencyLimitGauge.WithLabelValues("test_adapt")))
+
+	// A reload keeps the adapted limit within the new bounds.
+	for i := 0; i < 6; i++ {
+		l.release()
+	}
+	cfg = &config.ConcurrencyLimit{Enabled: true, InitialLimit: 8, MinLimit: 6, MaxLimit: 8, LatencyTarget: time.Second, BackoffRatio: 0.5}
+	require.True(t, l.acquire(cfg, false))
+	assert.Equal(t, 6.0, l.Limit())
+}
@@ -0,0 +1,232 @@
+package httpserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	HTTPHeaderNameLastModified      = "Last-Modified"
+	HTTPHeaderNameIfMatch           = "If-Match"
+	HTTPHeaderNameIfNoneMatch       = "If-None-Match"
+	HTTPHeaderNameIfModifiedSince   = "If-Modified-Since"
+	HTTPHeaderNameIfUnmodifiedSince = "If-Unmodified-Since"
+
+	ErrorCodePreconditionFailed = "precondition_failed"
+)
+
+// ValidatorsFunc returns the validators of the current representation of the resource r
+// targets. exists is false when there is none, a zero lastModified when it is unknown.
+type ValidatorsFunc func(r *http.Request) (etag string, lastModified time.Time, exists bool)
+
+// ValidatorsHandler is a handler which knows the validators of its resources, so that
+// conditional unsafe requests to it can be checked before it runs.
+type ValidatorsHandler interface {
+	http.Handler
+	CurrentValidators(r *http.Request) (etag string, lastModified time.Time, exists bool)
+}
+
+// ConditionalMiddleware answers conditional requests. Responses to GET and HEAD are buffered
+// and get an ETag unless the handler set one, computed from the body and weak if weak is set.
+// If-None-Match, or If-Modified-Since against the Last-Modified of the handler, turn matching
+// responses into 304.
+//
+// Unsafe methods with If-Match or If-Unmodified-Since are checked against the validators
+// current returns and answered with 412 when they do not match. If-Match uses the strong
+// comparison, so it never matches weak ETags. Without current the preconditions cannot be
+// evaluated and such requests always fail, rather than risking a lost update.
+func ConditionalMiddleware(weak bool, current ValidatorsFunc) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead:
+				serveConditional(next, w, r, weak)
+			case http.MethodOptions, http.MethodTrace, http.MethodConnect:
+				next.ServeHTTP(w, r)
+			default:
+				if checkPreconditions(current, w, r) {
+					next.ServeHTTP(w, r)
+				}
+			}
+		})
+	}
+}
+
+func serveConditional(next http.Handler, w http.ResponseWriter, r *http.Request, weak bool) {
+	buf := &bufferedResponse{header: w.Header()}
+	next.ServeHTTP(buf, r)
+	if buf.Status() != http.StatusOK {
+		buf.writeTo(w)
+		return
+	}
+
+	h := w.Header()
+	etag := h.Get(HTTPHeaderNameETag)
+	if etag == "" {
+		etag = computeETag(buf.body.Bytes(), weak)
+		h.Set(HTTPHeaderNameETag, etag)
+	}
+	if !notModified(r, etag, h.Get(HTTPHeaderNameLastModified)) {
+		buf.writeTo(w)
+		return
+	}
+	writeNotModified(w)
+}
+
+// writeNotModified answers 304 without the headers describing the body.
+func writeNotModified(w http.ResponseWriter) {
+	for _, k := range []string{HTTPHeaderNameContentType, HTTPHeaderNameContentLength, HTTPHeaderNameContentEncoding} {
+		w.Header().Del(k)
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// notModified reports whether a GET or HEAD request is answered by a representation with etag
+// and lastModified. If-Modified-Since is only evaluated without If-None-Match.
+func notModified(r *http.Request, etag, lastModified string) bool {
+	if inm := r.Header.Get(HTTPHeaderNameIfNoneMatch); inm != "" {
+		return etagListMatches(inm, etag, false)
+	}
+	ims := r.Header.Get(HTTPHeaderNameIfModifiedSince)
+	if ims == "" || lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	return err == nil && !modified.After(since)
+}
+
+// checkPreconditions answers 412 and returns false when the current representation does not
+// match If-Match or was modified after If-Unmodified-Since.
+func checkPreconditions(current ValidatorsFunc, w http.ResponseWriter, r *http.Request) bool {
+	im := r.Header.Get(HTTPHeaderNameIfMatch)
+	ius := r.Header.Get(HTTPHeaderNameIfUnmodifiedSince)
+	if im == "" && ius == "" {
+		return true
+	}
+
+	failed := current == nil
+	if !failed {
+		etag, lastModified, exists := current(r)
+		if im != "" {
+			failed = !exists || strings.TrimSpace(im) != "*" && !etagListMatches(im, etag, true)
+		} else if since, err := http.ParseTime(ius); err == nil && exists && !lastModified.IsZero() {
+			// Last-Modified has a resolution of seconds.
+			failed = lastModified.Truncate(time.Second).After(since)
+		}
+	}
+	if failed {
+		WriteError(w, r, http.StatusPreconditionFailed, ErrorBody{
+			Code:    ErrorCodePreconditionFailed,
+			Message: "the resource does not match the request preconditions",
+		})
+		return false
+	}
+	return true
+}
+
+// computeETag returns a quoted tag derived from the SHA-256 of body.
+func computeETag(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	tag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+// etagListMatches reports whether etag is among the entity tags of list, a header value of
+// If-Match or If-None-Match. The strong comparison requires both tags to be strong, the weak
+// one only compares the opaque tags. "*" matches any tag.
+func etagListMatches(list, etag string, strong bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return etag != ""
+	}
+	opaque, weak, ok := parseETag(etag)
+	if !ok || (strong && weak) {
+		return false
+	}
+	for list != "" {
+		list = strings.TrimLeft(list, " \t,")
+		if list == "" {
+			break
+		}
+		candidate, candidateWeak, rest, ok := scanETag(list)
+		if !ok {
+			return false
+		}
+		if candidate == opaque && !(strong && candidateWeak) {
+			return true
+		}
+		list = rest
+	}
+	return false
+}
+
+func parseETag(etag string) (opaque string, weak, ok bool) {
+	opaque, weak, rest, ok := scanETag(strings.TrimSpace(etag))
+	return opaque, weak, ok && rest == ""
+}
+
+// scanETag reads the entity tag s starts with and returns the quoted opaque tag and the rest of s.
+func scanETag(s string) (opaque string, weak bool, rest string, ok bool) {
+	if strings.HasPrefix(s, "W/") {
+		weak = true
+		s = s[2:]
+	}
+	if len(s) < 2 || s[0] != '"' {
+		return "", false, "", false
+	}
+	end := strings.IndexByte(s[1:], '"')
+	if end < 0 {
+		return "", false, "", false
+	}
+	return s[:end+2], weak, s[end+2:], true
+}
+
+// bufferedResponse holds a response back until the handler returned. Flushes are not
+// supported, the response is only complete at the end.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	// Informational responses are dropped, they cannot be sent after the fact.
+	if b.status == 0 && code >= http.StatusOK {
+		b.status = code
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// Status returns the status code written, 200 when the handler wrote nothing.
+func (b *bufferedResponse) Status() int {
+	if b.status == 0 {
+		return http.StatusOK
+	}
+	return b.status
+}
+
+// writeTo sends the buffered response to w, whose header map the handler already wrote to.
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	w.WriteHeader(b.Status())
+	w.Write(b.body.Bytes())
+}
@@ -0,0 +1,167 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalMiddleware(t *testing.T) {
+	body := "[1,2,3]"
+	handler := ConditionalMiddleware(false, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HTTPHeaderNameContentType, "application/json")
+		w.Write([]byte(body))
+	}))
+	serve := func(header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/lists", nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve()
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, body, rec.Body.String())
+	etag := rec.Header().Get(HTTPHeaderNameETag)
+	require.Regexp(t, `^"[A-Za-z0-9_-]+"$`, etag)
+
+	rec = serve(HTTPHeaderNameIfNoneMatch, `"other", `+etag)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, etag, rec.Header().Get(HTTPHeaderNameETag))
+	assert.Empty(t, rec.Header().Get(HTTPHeaderNameContentType))
+
+	// If-None-Match uses the weak comparison.
+	assert.Equal(t, http.StatusNotModified, serve(HTTPHeaderNameIfNoneMatch, "W/"+etag).Code)
+	assert.Equal(t, http.StatusNotModified, serve(HTTPHeaderNameIfNoneMatch, "*").Code)
+
+	body = "[1,2,3,4]"
+	rec = serve(HTTPHeaderNameIfNoneMatch, etag)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, body, rec.Body.String())
+	assert.NotEqual(t, etag, rec.Header().Get(HTTPHeaderNameETag))
+}
+
+func TestConditionalMiddleware_HandlerValidators(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	handler := ConditionalMiddleware(true, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HTTPHeaderNameETag, `"v1"`)
+		w.Header().Set(HTTPHeaderNameLastModified, modified.Format(http.TimeFormat))
+		w.Write([]byte("content"))
+	}))
+	serve := func(name, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/item", nil)
+		req.Header.Set(name, value)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(HTTPHeaderNameIfNoneMatch, `"v1"`)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Equal(t, `"v1"`, rec.Header().Get(HTTPHeaderNameETag))
+
+	assert.Equal(t, http.StatusNotModified, serve(HTTPHeaderNameIfModifiedSince, modified.Format(http.TimeFormat)).Code)
+	assert.Equal(t, http.StatusOK, serve(HTTPHeaderNameIfModifiedSince, modified.Add(-time.Second).Format(http.TimeFormat)).Code)
+	assert.Equal(t, http.StatusOK, serve(HTTPHeaderNameIfModifiedSince, "yesterday").Code)
+
+	// If-None-Match takes precedence over If-Modified-Since.
+	req := httptest.NewRequest(http.MethodGet, "/item", nil)
+	req.Header.Set(HTTPHeaderNameIfNoneMatch, `"v0"`)
+	req.Header.Set(HTTPHeaderNameIfModifiedSince, modified.Format(http.TimeFormat))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "content", rec.Body.String())
+}
+
+type versionedItem struct {
+	version  string
+	modified time.Time
+	calls    int
+}
+
+func (i *versionedItem) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	i.calls++
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (i *versionedItem) CurrentValidators(*http.Request) (string, time.Time, bool) {
+	return `"` + i.version + `"`, i.modified, i.version != ""
+}
+
+func TestConditionalMiddleware_Preconditions(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	item := &versionedItem{version: "v1", modified: modified}
+	handler := ConditionalMiddleware(false, item.CurrentValidators)(item)
+	put := func(name, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/item", nil)
+		req.Header.Set(name, value)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The handler runs once per request, the preconditions do not call it.
+	assert.Equal(t, http.StatusNoContent, put(HTTPHeaderNameIfMatch, `"v1"`).Code)
+	assert.Equal(t, 1, item.calls)
+	assert.Equal(t, http.StatusNoContent, put(HTTPHeaderNameIfMatch, "*").Code)
+	assert.Equal(t, http.StatusNoContent, put(HTTPHeaderNameIfUnmodifiedSince, modified.Format(http.TimeFormat)).Code)
+	assert.Equal(t, 3, item.calls)
+
+	// If-Match uses the strong comparison.
+	for _, ifMatch := range []string{`W/"v1"`, `"stale"`} {
+		rec := put(HTTPHeaderNameIfMatch, ifMatch)
+		require.Equal(t, http.StatusPreconditionFailed, rec.Code, ifMatch)
+		var resp ErrorResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, ErrorCodePreconditionFailed, resp.Error.Code)
+	}
+	assert.Equal(t, http.StatusPreconditionFailed, put(HTTPHeaderNameIfUnmodifiedSince, modified.Add(-time.Second).Format(http.TimeFormat)).Code)
+	assert.Equal(t, 3, item.calls)
+
+	item.version = ""
+	assert.Equal(t, http.StatusPreconditionFailed, put(HTTPHeaderNameIfMatch, "*").Code)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/item", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, 4, item.calls)
+
+	// Without validators the preconditions cannot hold.
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "/item", nil)
+	req.Header.Set(HTTPHeaderNameIfMatch, `"v1"`)
+	ConditionalMiddleware(false, nil)(item).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	assert.Equal(t, 4, item.calls)
+}
+
+func TestEtagListMatches(t *testing.T) {
+	tests := []struct {
+		list, etag string
+		strong     bool
+		want       bool
+	}{
+		{`"a"`, `"a"`, true, true},
+		{`"b", "a,c"`, `"a,c"`, true, true},
+		{`W/"a"`, `"a"`, false, true},
+		{`W/"a"`, `"a"`, true, false},
+		{`"a"`, `W/"a"`, true, false},
+		{`"a"`, `"b"`, false, false},
+		{`a`, `"a"`, false, false},
+		{`*`, `"a"`, true, true},
+		{`*`, ``, false, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, etagListMatches(tt.list, tt.etag, tt.strong), "%s against %s", tt.list, tt.etag)
+	}
+}
@@ -0,0 +1,181 @@
+package httpserver
+
+import (
+	"backend/config"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const ErrorCodeCorsRejected = "cors_rejected"
+
+// Methods allowed when a policy does not list any, the CORS safelisted methods.
+var defaultCorsMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+func CorsMiddleware(cors *config.Cors) func(http.Handler) http.Handler {
+	return DynamicCorsMiddleware(func() *config.Cors { return cors })
+}
+
+// DynamicCorsMiddleware looks up the CORS policy on every request,
+// so that it can be swapped on configuration reload.
+//
+// Only the matched origin is echoed in Access-Control-Allow-Origin. Requests from origins
+// the policy does not allow are rejected with 403, as are preflights asking for a method or
+// header outside the policy. OPTIONS requests which are not preflights reach the handler.
+// Requests without an Origin header and same-origin requests pass through untouched.
+func DynamicCorsMiddleware(settings func() *config.Cors) func(http.Handler) http.Handler {
+	var compiled atomic.Pointer[corsPolicy]
+	policy := func() *corsPolicy {
+		cors := settings()
+		if p := compiled.Load(); p != nil && p.source == cors {
+			return p
+		}
+		p := newCorsPolicy(cors)
+		compiled.Store(p)
+		return p
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add(HTTPHeaderNameVary, HTTPHeaderNameOrigin)
+			origin := r.Header.Get(HTTPHeaderNameOrigin)
+			if origin == "" || sameOrigin(r, origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			p := policy()
+			if !p.allowsOrigin(origin) {
+				WriteError(w, r, http.StatusForbidden, ErrorBody{
+					Code:    ErrorCodeCorsRejected,
+					Message: "origin " + origin + " is not allowed by the CORS policy",
+				})
+				return
+			}
+			if r.Method == http.MethodOptions && r.Header.Get(HTTPHeaderNameAccessControlReqMethod) != "" {
+				p.preflight(w, r, origin)
+				return
+			}
+
+			h := w.Header()
+			h.Set(HTTPHeaderNameAccessControlAllowOrigin, origin)
+			if p.cors.AllowCredentials {
+				h.Set(HTTPHeaderNameAccessControlAllowCreds, "true")
+			}
+			if len(p.cors.ExposeHeaders) > 0 {
+				h.Set(HTTPHeaderNameAccessControlExposeHdrs, strings.Join(p.cors.ExposeHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// corsPolicy is a config.Cors prepared for matching requests.
+type corsPolicy struct {
+	source     *config.Cors // identity of the settings it was built from
+	cors       config.Cors
+	origins    []config.OriginPattern
+	methods    []string
+	headers    map[string]bool
+	anyHeaders bool
+}
+
+// newCorsPolicy builds the policy of cors, a nil cors allows nothing.
+func newCorsPolicy(cors *config.Cors) *corsPolicy {
+	p := &corsPolicy{source: cors, headers: make(map[string]bool)}
+	if cors == nil {
+		return p
+	}
+	p.cors = *cors
+	// Invalid origins are reported by configuration validation, a policy with one allows no origin.
+	p.origins, _ = cors.ParsedOrigins()
+	for _, m := range cors.Methods {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m != http.MethodOptions {
+			p.methods = append(p.methods, m)
+		}
+	}
+	if len(p.methods) == 0 {
+		p.methods = defaultCorsMethods
+	}
+	for _, h := range cors.Headers {
+		h = strings.TrimSpace(h)
+		if h == "*" {
+			p.anyHeaders = true
+		}
+		p.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	return p
+}
+
+func (p *corsPolicy) allowsOrigin(origin string) bool {
+	for _, o := range p.origins {
+		if o.Match(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	h := w.Header()
+	h.Add(HTTPHeaderNameVary, HTTPHeaderNameAccessControlReqMethod)
+	h.Add(HTTPHeaderNameVary, HTTPHeaderNameAccessControlReqHeaders)
+
+	method := strings.ToUpper(r.Header.Get(HTTPHeaderNameAccessControlReqMethod))
+	if !slices.Contains(p.methods, method) {
+		WriteError(w, r, http.StatusForbidden, ErrorBody{
+			Code:    ErrorCodeCorsRejected,
+			Message: "method " + method + " is not allowed by the CORS policy",
+		})
+		return
+	}
+	requested := requestedHeaders(r)
+	for _, name := range requested {
+		if !p.anyHeaders && !p.headers[http.CanonicalHeaderKey(name)] {
+			WriteError(w, r, http.StatusForbidden, ErrorBody{
+				Code:    ErrorCodeCorsRejected,
+				Message: "header " + name + " is not allowed by the CORS policy",
+			})
+			return
+		}
+	}
+
+	h.Set(HTTPHeaderNameAccessControlAllowOrigin, origin)
+	h.Set(HTTPHeaderNameAccessControlAllowMethods, strings.Join(p.methods, ", "))
+	if len(requested) > 0 {
+		// Echo what was asked for, which also covers a * policy with credentials.
+		h.Set(HTTPHeaderNameAccessControlAllowHeaders, strings.Join(requested, ", "))
+	}
+	if p.cors.AllowCredentials {
+		h.Set(HTTPHeaderNameAccessControlAllowCreds, "true")
+	}
+	if p.cors.MaxAge > 0 {
+		h.Set(HTTPHeaderNameAccessControlMaxAge, strconv.Itoa(int(p.cors.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func requestedHeaders(r *http.Request) []string {
+	var names []string
+	for _, value := range r.Header.Values(HTTPHeaderNameAccessControlReqHeaders) {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// sameOrigin reports whether origin is the origin the request was sent to,
+// browsers send the Origin header on same-origin POST requests as well.
+func sameOrigin(r *http.Request, origin string) bool {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return strings.EqualFold(origin, scheme+"://"+r.Host)
+}
@@ -0,0 +1,82 @@
+package httpserver
+
+import (
+	"backend/config"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorsMiddleware(t *testing.T) {
+	cors := &config.Cors{
+		Origins:          []string{"https://reviews.swiggy.com", "https://*.swiggy.in", "regex:https://app-[0-9]+\\.example\\.org"},
+		Methods:          []string{"GET", "OPTIONS"},
+		Headers:          []string{"deviceid"},
+		ExposeHeaders:    []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	handler := CorsMiddleware(cors)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	assertRejected := func(rec *httptest.ResponseRecorder, msgAndArgs ...any) {
+		assert.Equal(t, http.StatusForbidden, rec.Code, msgAndArgs...)
+		var resp ErrorResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), msgAndArgs...)
+		assert.Equal(t, ErrorCodeCorsRejected, resp.Error.Code, msgAndArgs...)
+	}
+	serve := func(method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://api.swiggy.com/x", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, origin := range []string{"https://reviews.swiggy.com", "https://a.b.swiggy.in", "https://app-7.example.org"} {
+		rec := serve(http.MethodGet, origin, nil)
+		assert.Equal(t, http.StatusTeapot, rec.Code, origin)
+		assert.Equal(t, origin, rec.Header().Get("Access-Control-Allow-Origin"), origin)
+		assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "X-Request-ID", rec.Header().Get("Access-Control-Expose-Headers"))
+		assert.Equal(t, []string{"Origin"}, rec.Header().Values("Vary"))
+	}
+
+	for _, origin := range []string{"https://swiggy.in", "http://reviews.swiggy.com", "https://app-7.example.org.evil.com", "https://evil.com"} {
+		rec := serve(http.MethodGet, origin, nil)
+		assertRejected(rec, origin)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"), origin)
+	}
+
+	// No Origin and same origin requests are not CORS requests.
+	assert.Equal(t, http.StatusTeapot, serve(http.MethodGet, "", nil).Code)
+	assert.Equal(t, http.StatusTeapot, serve(http.MethodPost, "http://api.swiggy.com", nil).Code)
+	// OPTIONS without Access-Control-Request-Method is not a preflight.
+	assert.Equal(t, http.StatusTeapot, serve(http.MethodOptions, "https://reviews.swiggy.com", nil).Code)
+
+	rec := serve(http.MethodOptions, "https://reviews.swiggy.com", map[string]string{
+		"Access-Control-Request-Method":  "GET",
+		"Access-Control-Request-Headers": "DeviceId",
+	})
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://reviews.swiggy.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET", rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "DeviceId", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+
+	assertRejected(serve(http.MethodOptions, "https://reviews.swiggy.com", map[string]string{"Access-Control-Request-Method": "DELETE"}))
+	assertRejected(serve(http.MethodOptions, "https://reviews.swiggy.com", map[string]string{
+		"Access-Control-Request-Method":  "GET",
+		"Access-Control-Request-Headers": "authorization",
+	}))
+}
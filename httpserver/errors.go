@@ -0,0 +1,44 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes of the error envelope.
+const (
+	ErrorCodeInternal = "internal_error"
+)
+
+// ErrorResponse is the JSON envelope of every error the server itself answers with.
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+	// Stack is only filled in debug mode, see RecoveryMiddleware.
+	Stack string `json:"stack,omitempty"`
+}
+
+// WriteError answers r with the error envelope.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, body ErrorBody) {
+	if body.RequestID == "" {
+		body.RequestID = requestID(w, r)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: body})
+}
+
+// requestID returns the request id of r. Middlewares wrapping the route middlewares do not
+// see the id in the context, but the request id middleware has already set the response header.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	if reqID := GetReqID(r.Context()); reqID != "" {
+		return reqID
+	}
+	return w.Header().Get(HTTPHeaderNameRequestID)
+}
@@ -0,0 +1,37 @@
+package httpserver
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// HealthProbe reports whether the server should keep receiving traffic.
+// It starts out ready and is flipped to failing once shutdown begins, so that
+// load balancers stop routing requests to us before connections are drained.
+type HealthProbe struct {
+	ready atomic.Bool
+}
+
+func NewHealthProbe() *HealthProbe {
+	p := &HealthProbe{}
+	p.ready.Store(true)
+	return p
+}
+
+func (p *HealthProbe) SetReady(ready bool) {
+	p.ready.Store(ready)
+}
+
+func (p *HealthProbe) IsReady() bool {
+	return p.ready.Load()
+}
+
+// ServeHTTP answers readiness checks. 503 is returned while the server is draining.
+func (p *HealthProbe) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	if !p.IsReady() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("draining"))
+		return
+	}
+	w.Write([]byte("ready"))
+}
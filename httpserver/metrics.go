@@ -1,6 +1,7 @@
 package httpserver
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -12,6 +13,8 @@ type PathInstrumentor struct {
 	duration *prometheus.HistogramVec
 }
 
+// NewInstrumentor returns an instrumentor recording to the default registry. Instrumentors
+// created later in the same process share the metrics of the first one.
 func NewInstrumentor() *PathInstrumentor {
 
 	//counter for api requests
@@ -33,16 +36,39 @@ func NewInstrumentor() *PathInstrumentor {
 		},
 		[]string{"path", "method"},
 	)
-	prometheus.MustRegister(counter, duration)
-	return &PathInstrumentor{counter: counter, duration: duration}
+	return &PathInstrumentor{counter: registerOnce(counter), duration: registerOnce(duration)}
 }
 
-func (h *PathInstrumentor) Instrument(path string, f http.Handler) http.Handler {
+// registerOnce registers c with the default registry, or returns the equal collector which
+// is registered already.
+func registerOnce[C prometheus.Collector](c C) C {
+	err := prometheus.Register(c)
+	if err == nil {
+		return c
+	}
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		if existing, ok := registered.ExistingCollector.(C); ok {
+			return existing
+		}
+	}
+	panic(err)
+}
+
+// Instrument records request metrics of f under path and reports every request to observers.
+func (h *PathInstrumentor) Instrument(path string, f http.Handler, observers ...LatencyObserver) http.Handler {
+	f = observeLatency(f, observers...)
 
+	// Requests of sampled traces carry the trace id as exemplar, exposed in the OpenMetrics format.
+	exemplars := promhttp.WithExemplarFromContext(exemplarLabels)
 	instrumented := promhttp.InstrumentHandlerDuration(h.duration.MustCurryWith(prometheus.Labels{"path": path}),
-		promhttp.InstrumentHandlerCounter(h.counter.MustCurryWith(prometheus.Labels{"path": path}), f))
+		promhttp.InstrumentHandlerCounter(h.counter.MustCurryWith(prometheus.Labels{"path": path}), f, exemplars), exemplars)
 
-	return instrumented
+	// Exemplars carry the request id, which the route middlewares attach inside.
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, _ = withCapturedContext(r)
+		instrumented.ServeHTTP(w, r)
+	})
 }
 
 func (h *PathInstrumentor) Shutdown() {
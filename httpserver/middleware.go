@@ -4,6 +4,8 @@ import (
 	"backend/config"
 	"context"
 	"net/http"
+	"regexp"
+	"sync/atomic"
 
 	"github.com/google/uuid"
 )
@@ -11,12 +13,20 @@ import (
 const (
 	ContextKeyReqID                         string = "requestId"
 	ContextKeyCustomerID                    string = "customerId"
+	ContextKeyClientID                      string = "clientId" // identity from a verified client certificate
 	ContextKeyDeviceID                      string = "deviceId"
 	ContextKeySource                        string = "source"
 	HTTPHeaderNameRequestID                 string = "X-Request-ID"
 	HTTPHeaderNameAccessControlAllowOrigin  string = "Access-Control-Allow-Origin"
 	HTTPHeaderNameAccessControlAllowMethods string = "Access-Control-Allow-Methods"
 	HTTPHeaderNameAccessControlAllowHeaders string = "Access-Control-Allow-Headers"
+	HTTPHeaderNameAccessControlAllowCreds   string = "Access-Control-Allow-Credentials"
+	HTTPHeaderNameAccessControlExposeHdrs   string = "Access-Control-Expose-Headers"
+	HTTPHeaderNameAccessControlMaxAge       string = "Access-Control-Max-Age"
+	HTTPHeaderNameAccessControlReqMethod    string = "Access-Control-Request-Method"
+	HTTPHeaderNameAccessControlReqHeaders   string = "Access-Control-Request-Headers"
+	HTTPHeaderNameOrigin                    string = "Origin"
+	HTTPHeaderNameVary                      string = "Vary"
 )
 
 type Middleware func(next http.Handler) http.Handler
@@ -34,35 +44,57 @@ func ChainMiddleware(h http.Handler, middlewares ...Middleware) http.Handler {
 	return wrapper
 }
 
-func CorsMiddleware(cors *config.Cors) func(http.Handler) http.Handler {
+// RequestIdMiddleware accepts inbound X-Request-ID headers which pass the default checks
+// of config.RequestID and generates an id for every other request.
+func RequestIdMiddleware(next http.Handler) http.Handler {
+	return DynamicRequestIdMiddleware(func() *config.RequestID { return &config.RequestID{} })(next)
+}
+
+// DynamicRequestIdMiddleware keeps the X-Request-ID of the caller when it passes the length
+// and format checks of the current settings, otherwise a new id is generated. The id is
+// attached to the request context, see GetReqID, and echoed in the response.
+func DynamicRequestIdMiddleware(settings func() *config.RequestID) Middleware {
+	var compiled atomic.Pointer[requestIDPolicy]
+	policy := func() *requestIDPolicy {
+		cfg := settings()
+		if p := compiled.Load(); p != nil && p.source == cfg {
+			return p
+		}
+		p := newRequestIDPolicy(cfg)
+		compiled.Store(p)
+		return p
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header()[HTTPHeaderNameAccessControlAllowOrigin] = cors.Origins
-			w.Header()[HTTPHeaderNameAccessControlAllowMethods] = cors.Methods
-			w.Header()[HTTPHeaderNameAccessControlAllowHeaders] = cors.Headers
-
-			if r.Method == http.MethodOptions {
-				w.WriteHeader(http.StatusNoContent)
-				return
-			} else {
-				next.ServeHTTP(w, r)
+			reqID := r.Header.Get(HTTPHeaderNameRequestID)
+			if !policy().accepts(reqID) {
+				reqID = genReqId()
 			}
+			ctx := AttachToCtx(r.Context(), ContextKeyReqID, reqID)
+			tagSpanWithReqID(ctx, reqID)
+			r = r.WithContext(ctx)
+			w.Header().Set(HTTPHeaderNameRequestID, reqID)
+
+			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-func RequestIdMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := attachReqID(r.Context())
-		r = r.WithContext(ctx)
-		w.Header().Set(HTTPHeaderNameRequestID, GetReqID(ctx))
+type requestIDPolicy struct {
+	source    *config.RequestID
+	maxLength int
+	pattern   *regexp.Regexp
+}
 
-		next.ServeHTTP(w, r)
-	})
+// newRequestIDPolicy prepares cfg, with an invalid pattern every inbound id is replaced.
+func newRequestIDPolicy(cfg *config.RequestID) *requestIDPolicy {
+	pattern, _ := cfg.ParsedPattern()
+	return &requestIDPolicy{source: cfg, maxLength: cfg.ParsedMaxLength(), pattern: pattern}
 }
-func attachReqID(ctx context.Context) context.Context {
-	reqID := genReqId()
-	return AttachToCtx(ctx, ContextKeyReqID, reqID)
+
+func (p *requestIDPolicy) accepts(reqID string) bool {
+	return reqID != "" && len(reqID) <= p.maxLength && p.pattern != nil && p.pattern.MatchString(reqID)
 }
 
 func GetReqID(ctx context.Context) string {
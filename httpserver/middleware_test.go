@@ -0,0 +1,64 @@
+package httpserver
+
+import (
+	"backend/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestIdMiddleware(t *testing.T) {
+	var seen string
+	handler := DynamicRequestIdMiddleware(func() *config.RequestID {
+		return &config.RequestID{MaxLength: 16}
+	})(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		seen = GetReqID(r.Context())
+	}))
+
+	for inbound, kept := range map[string]bool{
+		"abc-123":               true,
+		"":                      false,
+		"has space":             false,
+		"waaaaaaaaaytoolong-1":  false,
+		strings.Repeat("a", 16): true,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HTTPHeaderNameRequestID, inbound)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		require.NotEmpty(t, seen, inbound)
+		assert.Equal(t, seen, rec.Header().Get(HTTPHeaderNameRequestID), inbound)
+		assert.Equal(t, kept, seen == inbound, inbound)
+	}
+}
+
+func TestRequestIdTransport(t *testing.T) {
+	var got []string
+	downstream := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get(HTTPHeaderNameRequestID))
+	}))
+	defer downstream.Close()
+	client := &http.Client{Transport: RequestIdTransport(nil)}
+
+	ctx := AttachToCtx(httptest.NewRequest(http.MethodGet, "/", nil).Context(), ContextKeyReqID, "abc-123")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downstream.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, req.Header.Get(HTTPHeaderNameRequestID), "the caller's request must not be modified")
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, downstream.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set(HTTPHeaderNameRequestID, "explicit")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, []string{"abc-123", "explicit"}, got)
+}
@@ -0,0 +1,41 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+)
+
+// InjectReqID sets the request id of ctx on an outbound request, so that the downstream
+// service logs the same id. Requests which already carry an X-Request-ID are left alone.
+func InjectReqID(ctx context.Context, req *http.Request) {
+	if reqID := GetReqID(ctx); reqID != "" && req.Header.Get(HTTPHeaderNameRequestID) == "" {
+		req.Header.Set(HTTPHeaderNameRequestID, reqID)
+	}
+}
+
+// RequestIdTransport injects the request id of every outbound request's context, see InjectReqID.
+// A nil base uses http.DefaultTransport. Build outbound requests with http.NewRequestWithContext
+// from the inbound request context:
+//
+//	client := &http.Client{Transport: httpserver.RequestIdTransport(nil)}
+func RequestIdTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return requestIDTransport{base: base}
+}
+
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (t requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqID := GetReqID(req.Context())
+	if reqID == "" || req.Header.Get(HTTPHeaderNameRequestID) != "" {
+		return t.base.RoundTrip(req)
+	}
+	// A RoundTripper must not modify the caller's request.
+	req = req.Clone(req.Context())
+	req.Header.Set(HTTPHeaderNameRequestID, reqID)
+	return t.base.RoundTrip(req)
+}
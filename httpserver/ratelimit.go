@@ -0,0 +1,334 @@
+package httpserver
+
+import (
+	"backend/bigcache"
+	"backend/config"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	ErrorCodeRateLimited = "rate_limited"
+
+	HTTPHeaderNameRetryAfter         = "Retry-After"
+	HTTPHeaderNameRateLimitLimit     = "RateLimit-Limit"
+	HTTPHeaderNameRateLimitRemaining = "RateLimit-Remaining"
+	HTTPHeaderNameRateLimitReset     = "RateLimit-Reset"
+	HTTPHeaderNameRateLimitPolicy    = "RateLimit-Policy"
+)
+
+var rateLimitRejectionsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "foundation_gateway_service",
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected with 429 by the rate limit of their route.",
+	},
+	[]string{"path"},
+)
+
+func init() {
+	prometheus.MustRegister(rateLimitRejectionsCounter)
+}
+
+// RateLimitStore keeps the state of rate limits. Update has to be atomic per key: it passes
+// the state stored under key, nil if there is none, to update and stores what update returns.
+// The state may be dropped once ttl has passed.
+type RateLimitStore interface {
+	Update(key string, ttl time.Duration, update func(state []byte) []byte) error
+}
+
+// RateLimitMiddleware limits requests to route by settings(), see config.RateLimit.
+// stores maps the names of config.RateLimitStores to their implementation, the client IP is
+// resolved with the TRUSTED_PROXIES of accessLog().
+//
+// Every response carries the RateLimit-* headers, rejected requests get a 429 with
+// Retry-After. The limit fails open: requests pass when the store is missing or fails.
+func RateLimitMiddleware(route string, settings func() *config.RateLimit,
+	stores map[string]RateLimitStore, accessLog func() *config.AccessLog) Middleware {
+	var compiled atomic.Pointer[rateLimitPolicy]
+	policy := func() *rateLimitPolicy {
+		cfg, logCfg := settings(), accessLog()
+		if p := compiled.Load(); p != nil && p.source == cfg && p.logSource == logCfg {
+			return p
+		}
+		p := newRateLimitPolicy(cfg, logCfg)
+		compiled.Store(p)
+		return p
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := policy()
+			store := stores[p.store]
+			if p.limiter == nil || store == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var d rateLimitDecision
+			now := time.Now()
+			err := store.Update(route+"|"+p.key(r), p.limiter.ttl(now), func(state []byte) []byte {
+				state, d = p.limiter.take(state, now)
+				return state
+			})
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set(HTTPHeaderNameRateLimitLimit, strconv.Itoa(d.limit))
+			h.Set(HTTPHeaderNameRateLimitRemaining, strconv.Itoa(d.remaining))
+			h.Set(HTTPHeaderNameRateLimitReset, strconv.Itoa(ceilSeconds(d.reset)))
+			h.Set(HTTPHeaderNameRateLimitPolicy, p.header)
+			if !d.allowed {
+				rateLimitRejectionsCounter.WithLabelValues(route).Inc()
+				h.Set(HTTPHeaderNameRetryAfter, strconv.Itoa(max(ceilSeconds(d.retryAfter), 1)))
+				WriteError(w, r, http.StatusTooManyRequests, ErrorBody{
+					Code:    ErrorCodeRateLimited,
+					Message: "too many requests",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type rateLimitPolicy struct {
+	source    *config.RateLimit
+	logSource *config.AccessLog
+	limiter   rateLimiter
+	keyBy     string
+	apiKey    string
+	store     string
+	header    string
+	proxies   []netip.Prefix
+}
+
+// newRateLimitPolicy prepares cfg, a nil or invalid cfg lets every request pass.
+// Invalid settings are reported by configuration validation.
+func newRateLimitPolicy(cfg *config.RateLimit, accessLog *config.AccessLog) *rateLimitPolicy {
+	p := &rateLimitPolicy{source: cfg, logSource: accessLog}
+	if accessLog != nil {
+		p.proxies, _ = accessLog.ParsedTrustedProxies()
+	}
+	if cfg == nil || cfg.Limit < 1 || cfg.Window <= 0 {
+		return p
+	}
+	p.keyBy = cfg.ParsedKey()
+	p.apiKey = cfg.ParsedAPIKeyHeader()
+	p.store = cfg.ParsedStore()
+	p.header = fmt.Sprintf("%d;w=%d", cfg.Limit, ceilSeconds(cfg.Window))
+	switch cfg.ParsedAlgorithm() {
+	case config.RateLimitTokenBucket:
+		burst := max(cfg.ParsedBurst(), 1)
+		p.limiter = &tokenBucket{capacity: float64(burst), perSecond: float64(cfg.Limit) / cfg.Window.Seconds()}
+		p.header += ";burst=" + strconv.Itoa(burst)
+	case config.RateLimitSlidingWindow:
+		p.limiter = &slidingWindow{limit: cfg.Limit, window: cfg.Window}
+	}
+	return p
+}
+
+// key identifies the caller of r, requests without the configured value fall back to the client IP.
+func (p *rateLimitPolicy) key(r *http.Request) string {
+	switch p.keyBy {
+	case config.RateLimitKeyCustomerID, config.RateLimitKeyDeviceID:
+		if v, _ := r.Context().Value(p.keyBy).(string); v != "" {
+			return p.keyBy + ":" + v
+		}
+	case config.RateLimitKeyAPIKey:
+		if v := r.Header.Get(p.apiKey); v != "" {
+			// API keys are credentials, keep only a digest of them in the store.
+			sum := sha256.Sum256([]byte(v))
+			return p.keyBy + ":" + hex.EncodeToString(sum[:16])
+		}
+	}
+	return config.RateLimitKeyIP + ":" + ClientIP(r, p.proxies)
+}
+
+type rateLimitDecision struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// rateLimiter takes one request from state, which is nil or a state the limiter returned before.
+type rateLimiter interface {
+	take(state []byte, now time.Time) ([]byte, rateLimitDecision)
+	// ttl is how long a state written at now matters.
+	ttl(now time.Time) time.Duration
+}
+
+// tokenBucket state is the number of tokens and the time they were counted.
+type tokenBucket struct {
+	capacity  float64
+	perSecond float64
+}
+
+func (b *tokenBucket) take(state []byte, now time.Time) ([]byte, rateLimitDecision) {
+	tokens := b.capacity
+	if len(state) == 16 {
+		tokens = math.Float64frombits(binary.BigEndian.Uint64(state))
+		elapsed := now.Sub(time.Unix(0, int64(binary.BigEndian.Uint64(state[8:])))).Seconds()
+		if elapsed > 0 {
+			tokens = math.Min(b.capacity, tokens+elapsed*b.perSecond)
+		}
+	}
+	d := rateLimitDecision{limit: int(b.capacity)}
+	if tokens >= 1 {
+		tokens--
+		d.allowed = true
+	} else {
+		d.retryAfter = b.duration(1 - tokens)
+	}
+	d.remaining = int(tokens)
+	d.reset = b.duration(b.capacity - tokens)
+
+	state = make([]byte, 16)
+	binary.BigEndian.PutUint64(state, math.Float64bits(tokens))
+	binary.BigEndian.PutUint64(state[8:], uint64(now.UnixNano()))
+	return state, d
+}
+
+// ttl is the time an empty bucket takes to fill up, a full bucket needs no state.
+func (b *tokenBucket) ttl(time.Time) time.Duration {
+	return b.duration(b.capacity)
+}
+
+func (b *tokenBucket) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / b.perSecond * float64(time.Second))
+}
+
+// slidingWindow state is the start of the current window and the counts of it and the previous one.
+type slidingWindow struct {
+	limit  int
+	window time.Duration
+}
+
+func (s *slidingWindow) take(state []byte, now time.Time) ([]byte, rateLimitDecision) {
+	start := now.Truncate(s.window)
+	var prev, curr int64
+	if len(state) == 24 {
+		switch stored := time.Unix(0, int64(binary.BigEndian.Uint64(state))); {
+		case stored.Equal(start):
+			prev = int64(binary.BigEndian.Uint64(state[8:]))
+			curr = int64(binary.BigEndian.Uint64(state[16:]))
+		case stored.Add(s.window).Equal(start):
+			prev = int64(binary.BigEndian.Uint64(state[16:]))
+		}
+	}
+
+	elapsed := now.Sub(start)
+	left := s.window - elapsed
+	estimate := float64(prev)*float64(left)/float64(s.window) + float64(curr)
+	d := rateLimitDecision{limit: s.limit, reset: left}
+	if estimate+1 <= float64(s.limit) {
+		curr++
+		estimate++
+		d.allowed = true
+	} else {
+		// The estimate drops as the previous window slides out, or resets with the next one.
+		d.retryAfter = left
+		if prev > 0 {
+			if wait := time.Duration((estimate + 1 - float64(s.limit)) / float64(prev) * float64(s.window)); wait < left {
+				d.retryAfter = wait
+			}
+		}
+	}
+	d.remaining = max(s.limit-int(math.Ceil(estimate)), 0)
+
+	state = make([]byte, 24)
+	binary.BigEndian.PutUint64(state, uint64(start.UnixNano()))
+	binary.BigEndian.PutUint64(state[8:], uint64(prev))
+	binary.BigEndian.PutUint64(state[16:], uint64(curr))
+	return state, d
+}
+
+// ttl lasts until the current window stopped overlapping the sliding one.
+func (s *slidingWindow) ttl(now time.Time) time.Duration {
+	return 2*s.window - now.Sub(now.Truncate(s.window))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryRateLimitStore keeps rate limit state in a map of the process, expired entries are
+// swept once a minute.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryRateLimitEntry
+	lastSweep time.Time
+}
+
+type memoryRateLimitEntry struct {
+	state   []byte
+	expires time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{entries: make(map[string]memoryRateLimitEntry), lastSweep: time.Now()}
+}
+
+func (s *MemoryRateLimitStore) Update(key string, ttl time.Duration, update func(state []byte) []byte) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	var state []byte
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		state = e.state
+	}
+	s.entries[key] = memoryRateLimitEntry{state: update(state), expires: now.Add(ttl)}
+	return nil
+}
+
+// CacheRateLimitStore keeps rate limit state in a bigcache.Cache, usually the one of the
+// application, so that limits share its memory budget. Entries live as long as the cache
+// keeps them regardless of ttl, a cache TTL shorter than a window resets limits early.
+type CacheRateLimitStore struct {
+	cache bigcache.Cache
+	locks [64]sync.Mutex
+}
+
+func NewCacheRateLimitStore(cache bigcache.Cache) *CacheRateLimitStore {
+	return &CacheRateLimitStore{cache: cache}
+}
+
+func (s *CacheRateLimitStore) Update(key string, _ time.Duration, update func(state []byte) []byte) error {
+	key = "ratelimit|" + key
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	mu := &s.locks[h.Sum32()%uint32(len(s.locks))]
+	mu.Lock()
+	defer mu.Unlock()
+
+	state, _, err := s.cache.GetValue(key)
+	if err != nil {
+		return err
+	}
+	return s.cache.SetValue(key, update(state))
+}
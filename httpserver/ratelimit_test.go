@@ -0,0 +1,130 @@
+package httpserver
+
+import (
+	"backend/config"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limit := &config.RateLimit{Limit: 2, Window: time.Minute, Key: config.RateLimitKeyDeviceID}
+	accessLog := &config.AccessLog{TrustedProxies: []string{"10.0.0.0/8"}}
+	stores := map[string]RateLimitStore{config.RateLimitStoreMemory: NewMemoryRateLimitStore()}
+	handler := RateLimitMiddleware("/limited", func() *config.RateLimit { return limit }, stores,
+		func() *config.AccessLog { return accessLog })(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	before := testutil.ToFloat64(rateLimitRejectionsCounter.WithLabelValues("/limited"))
+
+	serve := func(deviceID, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+		req.RemoteAddr = "10.1.1.1:4711"
+		req.Header.Set(HTTPHeaderNameForwardedFor, forwardedFor)
+		if deviceID != "" {
+			req = req.WithContext(context.WithValue(req.Context(), ContextKeyDeviceID, deviceID))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("d1", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(HTTPHeaderNameRateLimitLimit))
+	assert.Equal(t, "1", rec.Header().Get(HTTPHeaderNameRateLimitRemaining))
+	assert.Equal(t, "30", rec.Header().Get(HTTPHeaderNameRateLimitReset))
+	assert.Equal(t, "2;w=60;burst=2", rec.Header().Get(HTTPHeaderNameRateLimitPolicy))
+	assert.Equal(t, http.StatusNoContent, serve("d1", "").Code)
+
+	rec = serve("d1", "")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "30", rec.Header().Get(HTTPHeaderNameRetryAfter))
+	assert.Equal(t, "0", rec.Header().Get(HTTPHeaderNameRateLimitRemaining))
+	assert.Contains(t, rec.Body.String(), `"code":"rate_limited"`)
+	assert.Equal(t, before+1, testutil.ToFloat64(rateLimitRejectionsCounter.WithLabelValues("/limited")))
+
+	// Other devices have their own bucket, requests without a device id are limited by client IP.
+	assert.Equal(t, http.StatusNoContent, serve("d2", "").Code)
+	assert.Equal(t, http.StatusNoContent, serve("", "203.0.113.7").Code)
+	assert.Equal(t, http.StatusNoContent, serve("", "203.0.113.7").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("", "203.0.113.7").Code)
+	assert.Equal(t, http.StatusNoContent, serve("", "203.0.113.8").Code)
+
+	// A policy removed on reload lets every request pass.
+	limit = nil
+	assert.Equal(t, http.StatusNoContent, serve("d1", "").Code)
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := &tokenBucket{capacity: 3, perSecond: 1}
+	now := time.Unix(1000, 0)
+
+	var state []byte
+	var d rateLimitDecision
+	for i := 0; i < 3; i++ {
+		state, d = b.take(state, now)
+		assert.True(t, d.allowed)
+	}
+	assert.Equal(t, 0, d.remaining)
+	assert.Equal(t, 3*time.Second, d.reset)
+
+	state, d = b.take(state, now.Add(500*time.Millisecond))
+	assert.False(t, d.allowed)
+	assert.Equal(t, 500*time.Millisecond, d.retryAfter)
+
+	_, d = b.take(state, now.Add(time.Second))
+	assert.True(t, d.allowed)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	s := &slidingWindow{limit: 4, window: 10 * time.Second}
+	start := time.Unix(1000, 0)
+
+	var state []byte
+	var d rateLimitDecision
+	for i := 0; i < 4; i++ {
+		state, d = s.take(state, start.Add(5*time.Second))
+		assert.True(t, d.allowed)
+	}
+	state, d = s.take(state, start.Add(9*time.Second))
+	assert.False(t, d.allowed)
+	assert.Equal(t, time.Second, d.retryAfter)
+
+	// Halfway through the next window half of the previous count still applies.
+	state, d = s.take(state, start.Add(15*time.Second))
+	assert.True(t, d.allowed)
+	assert.Equal(t, 1, d.remaining)
+	state, d = s.take(state, start.Add(15*time.Second))
+	assert.True(t, d.allowed)
+	_, d = s.take(state, start.Add(15*time.Second))
+	assert.False(t, d.allowed)
+	assert.Equal(t, 2500*time.Millisecond, d.retryAfter)
+
+	// Windows further back are forgotten.
+	_, d = s.take(state, start.Add(35*time.Second))
+	assert.True(t, d.allowed)
+	assert.Equal(t, 3, d.remaining)
+}
+
+func TestCacheRateLimitStore(t *testing.T) {
+	store := NewCacheRateLimitStore(&mapCache{entries: map[string][]byte{}})
+
+	var seen []byte
+	require.NoError(t, store.Update("k", time.Minute, func(state []byte) []byte {
+		seen = state
+		return []byte("1")
+	}))
+	assert.Nil(t, seen)
+	require.NoError(t, store.Update("k", time.Minute, func(state []byte) []byte {
+		seen = state
+		return []byte("2")
+	}))
+	assert.Equal(t, []byte("1"), seen)
+}
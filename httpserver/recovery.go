@@ -0,0 +1,71 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var panicsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "foundation_gateway_service",
+		Name:      "panics_total",
+		Help:      "Panics recovered from handlers per route.",
+	},
+	[]string{"path"},
+)
+
+func init() {
+	prometheus.MustRegister(panicsCounter)
+}
+
+// RecoveryMiddleware turns a panic of the handler of route into a JSON 500 response,
+// logs it with its stack and counts it in panics_total. exposeStack is asked on every
+// panic whether the stack goes into the response as well, it may be nil.
+//
+// Panics passed on by TimeoutMiddleware are reported with the stack of the handler.
+// A response that has already started cannot be replaced, the connection is closed then.
+// http.ErrAbortHandler is passed on as net/http uses it to abort a response on purpose.
+func RecoveryMiddleware(route string, logger *zap.Logger, exposeStack func() bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := newStatusRecorder(w)
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if err, ok := p.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+					panic(p)
+				}
+				stack := debug.Stack()
+				if hp, ok := p.(*handlerPanic); ok {
+					p, stack = hp.value, hp.stack
+				}
+				panicsCounter.WithLabelValues(route).Inc()
+				logger.Error("panic serving request",
+					zap.String("panic", fmt.Sprint(p)),
+					zap.String("path", route),
+					zap.String("method", r.Method),
+					zap.String(ContextKeyReqID, requestID(w, r)),
+					zap.ByteString("stack", stack),
+				)
+
+				if rec.status != 0 {
+					panic(http.ErrAbortHandler)
+				}
+				body := ErrorBody{Code: ErrorCodeInternal, Message: "internal server error"}
+				if exposeStack != nil && exposeStack() {
+					body.Message = fmt.Sprintf("panic: %v", p)
+					body.Stack = string(stack)
+				}
+				WriteError(w, r, http.StatusInternalServerError, body)
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
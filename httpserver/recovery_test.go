@@ -0,0 +1,75 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	debug := false
+	r := NewAdminRouter(zap.NewNop())
+	r.(*router).opts.ExposePanics = func() bool { return debug }
+	r.AddRoute(RouteConfig{
+		Path: "/boom",
+		Handler: RequestIdMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			panic("boom")
+		})),
+	})
+	before := testutil.ToFloat64(panicsCounter.WithLabelValues("/boom"))
+
+	serve := func() ErrorResponse {
+		req := httptest.NewRequest(http.MethodGet, "/boom", nil)
+		req.Header.Set(HTTPHeaderNameRequestID, "req-1")
+		rec := httptest.NewRecorder()
+		r.Mux().ServeHTTP(rec, req)
+		require.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+		var resp ErrorResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+
+	resp := serve()
+	assert.Equal(t, ErrorBody{Code: ErrorCodeInternal, Message: "internal server error", RequestID: "req-1"}, resp.Error)
+
+	debug = true
+	resp = serve()
+	assert.Equal(t, "panic: boom", resp.Error.Message)
+	assert.Contains(t, resp.Error.Stack, "recovery_test.go")
+
+	assert.Equal(t, before+2, testutil.ToFloat64(panicsCounter.WithLabelValues("/boom")))
+}
+
+func panickingHandler(http.ResponseWriter, *http.Request) {
+	panic("boom")
+}
+
+func TestRecoveryMiddleware_TimeoutPanic(t *testing.T) {
+	core, logs := observer.New(zapcore.ErrorLevel)
+	handler := ChainMiddleware(http.HandlerFunc(panickingHandler),
+		RecoveryMiddleware("/boom", zap.New(core), func() bool { return true }),
+		TimeoutMiddleware("/boom", time.Second, 0))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/boom", nil))
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "panic: boom", resp.Error.Message)
+	assert.Contains(t, resp.Error.Stack, "httpserver.panickingHandler")
+
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "boom", entries[0].ContextMap()["panic"])
+	assert.Contains(t, entries[0].ContextMap()["stack"], "httpserver.panickingHandler")
+}
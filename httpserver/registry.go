@@ -0,0 +1,143 @@
+package httpserver
+
+import (
+	"backend/config"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MiddlewareFactory builds the middleware for one route. It receives the handler name and
+// the route so that middlewares can be configured per route, e.g. a rate limit per handler.
+type MiddlewareFactory func(name string, route config.Route) (Middleware, error)
+
+// RouteRegistry maps the handler and middleware names used in the ROUTES config section
+// to their implementations. Handlers and middlewares are registered once at startup,
+// Mount then wires the routes as configured.
+type RouteRegistry struct {
+	mu          sync.RWMutex
+	handlers    map[string]http.Handler
+	middlewares map[string]MiddlewareFactory
+}
+
+func NewRouteRegistry() *RouteRegistry {
+	return &RouteRegistry{
+		handlers:    make(map[string]http.Handler),
+		middlewares: make(map[string]MiddlewareFactory),
+	}
+}
+
+// Handle registers h under name. Names are case-insensitive like config keys.
+func (r *RouteRegistry) Handle(name string, h http.Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[strings.ToLower(name)] = h
+}
+
+// Middleware registers the factory of the middleware name.
+func (r *RouteRegistry) Middleware(name string, f MiddlewareFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middlewares[strings.ToLower(name)] = f
+}
+
+// StaticMiddleware registers a middleware which is the same for every route.
+func (r *RouteRegistry) StaticMiddleware(name string, m Middleware) {
+	r.Middleware(name, func(string, config.Route) (Middleware, error) { return m, nil })
+}
+
+// Check reports every route which refers to an unknown handler or middleware
+// or whose middlewares cannot be built, as a config.ValidationError.
+func (r *RouteRegistry) Check(routes map[string]config.Route) error {
+	_, err := r.build(routes)
+	return err
+}
+
+// Mount adds all routes to router. Nothing is added when any route cannot be wired.
+func (r *RouteRegistry) Mount(router Router, routes map[string]config.Route) error {
+	built, err := r.build(routes)
+	if err != nil {
+		return err
+	}
+	for _, route := range built {
+		router.AddRoute(route)
+	}
+	return nil
+}
+
+func (r *RouteRegistry) build(routes map[string]config.Route) ([]RouteConfig, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var errs config.ValidationError
+	addf := func(path, format string, args ...any) {
+		errs = append(errs, config.FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	built := make([]RouteConfig, 0, len(routes))
+	for _, name := range config.RouteNames(routes) {
+		route := routes[name]
+		h, ok := r.handlers[name]
+		if !ok {
+			addf("ROUTES."+name, "unknown handler %q, registered handlers: %s", name, strings.Join(sortedKeys(r.handlers), ", "))
+		}
+		middlewares := make([]Middleware, 0, len(route.Middlewares))
+		for i, mwName := range route.Middlewares {
+			path := fmt.Sprintf("ROUTES.%s.MIDDLEWARES[%d]", name, i)
+			factory, found := r.middlewares[strings.ToLower(strings.TrimSpace(mwName))]
+			if !found {
+				addf(path, "unknown middleware %q, registered middlewares: %s", mwName, strings.Join(sortedKeys(r.middlewares), ", "))
+				continue
+			}
+			mw, err := factory(name, route)
+			if err != nil {
+				addf(path, "%s: %v", mwName, err)
+				continue
+			}
+			middlewares = append(middlewares, mw)
+		}
+		if !ok {
+			continue
+		}
+		// ETags are computed on the identity body the handler wrote, inside compress and cache.
+		if route.ETag != "" {
+			var current ValidatorsFunc
+			if vh, ok := h.(ValidatorsHandler); ok {
+				current = vh.CurrentValidators
+			}
+			middlewares = append(middlewares, ConditionalMiddleware(route.ETag == config.ETagWeak, current))
+		}
+		// The deadline starts inside the middlewares, so that the timeout error still carries
+		// the headers they set, such as the request id and CORS.
+		middlewares = append(middlewares, captureContext)
+		if route.Timeout > 0 {
+			middlewares = append(middlewares, TimeoutMiddleware(route.Path, route.Timeout, route.TimeoutStatus))
+		}
+		rc := RouteConfig{
+			Path:       route.Path,
+			Handler:    ChainMiddleware(h, middlewares...),
+			Methods:    route.Methods,
+			Instrument: route.Instrument,
+			AccessLog:  route.AccessLog,
+		}
+		if limit := route.ConcurrencyLimit; limit != nil {
+			rc.ConcurrencyLimit = func() *config.ConcurrencyLimit { return limit }
+		}
+		built = append(built, rc)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return built, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,100 @@
+package httpserver
+
+import (
+	"backend/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRouteRegistry_Mount(t *testing.T) {
+	registry := NewRouteRegistry()
+	registry.Handle("hello", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(w.Header().Get("X-Order")))
+	}))
+	for _, name := range []string{"first", "second"} {
+		name := name
+		registry.StaticMiddleware(name, func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Order", w.Header().Get("X-Order")+name+",")
+				next.ServeHTTP(w, r)
+			})
+		})
+	}
+
+	router := NewAdminRouter(zap.NewNop())
+	require.NoError(t, registry.Mount(router, map[string]config.Route{
+		"hello": {Path: "/hello", Methods: []string{http.MethodGet}, Middlewares: []string{"second", "first"}},
+	}))
+
+	rec := httptest.NewRecorder()
+	router.Mux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello", nil))
+	assert.Equal(t, "second,first,", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	router.Mux().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/hello", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestRouteRegistry_UnknownNames(t *testing.T) {
+	registry := NewRouteRegistry()
+	registry.Handle("hello", http.NotFoundHandler())
+
+	err := registry.Check(map[string]config.Route{
+		"hello":   {Path: "/hello", Middlewares: []string{"auth"}},
+		"missing": {Path: "/missing"},
+	})
+	var verr config.ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr, 2)
+	assert.Equal(t, "ROUTES.hello.MIDDLEWARES[0]", verr[0].Path)
+	assert.Equal(t, "ROUTES.missing", verr[1].Path)
+}
+
+func TestRouteRegistry_ETagInsideMiddlewares(t *testing.T) {
+	cfg := &config.Compression{Enabled: true, MinSize: 10}
+	item := &versionedItem{version: "v1"}
+	registry := NewRouteRegistry()
+	registry.Handle("item", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HTTPHeaderNameContentType, "text/plain")
+		w.Write([]byte(strings.Repeat("item ", 100)))
+	}))
+	registry.Handle("versioned", item)
+	registry.StaticMiddleware("compress", CompressionMiddleware("/item", func() *config.Compression { return cfg }))
+
+	router := NewAdminRouter(zap.NewNop())
+	require.NoError(t, registry.Mount(router, map[string]config.Route{
+		"item":      {Path: "/item", Methods: []string{http.MethodGet}, ETag: config.ETagStrong, Middlewares: []string{"compress"}},
+		"versioned": {Path: "/versioned", Methods: []string{http.MethodPut}, ETag: config.ETagStrong, Middlewares: []string{"compress"}},
+	}))
+	serve := func(method, target string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		router.Mux().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The ETag is computed on the identity body, compression only weakens it.
+	identity := serve(http.MethodGet, "/item")
+	require.Equal(t, http.StatusOK, identity.Code)
+	etag := identity.Header().Get(HTTPHeaderNameETag)
+	compressed := serve(http.MethodGet, "/item", HTTPHeaderNameAcceptEncoding, "gzip")
+	assert.Equal(t, "gzip", compressed.Header().Get(HTTPHeaderNameContentEncoding))
+	assert.Equal(t, "W/"+etag, compressed.Header().Get(HTTPHeaderNameETag))
+	rec := serve(http.MethodGet, "/item", HTTPHeaderNameAcceptEncoding, "gzip", HTTPHeaderNameIfNoneMatch, "W/"+etag)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Header().Get(HTTPHeaderNameContentEncoding))
+
+	// Validators of the handler check unsafe requests, which run it once.
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodPut, "/versioned", HTTPHeaderNameIfMatch, `"v1"`).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, serve(http.MethodPut, "/versioned", HTTPHeaderNameIfMatch, `"v0"`).Code)
+	assert.Equal(t, 1, item.calls)
+}
@@ -0,0 +1,386 @@
+package httpserver
+
+import (
+	"backend/bigcache"
+	"backend/config"
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	HTTPHeaderNameXCache        = "X-Cache"
+	HTTPHeaderNameAge           = "Age"
+	HTTPHeaderNamePragma        = "Pragma"
+	HTTPHeaderNameSetCookie     = "Set-Cookie"
+	HTTPHeaderNameAuthorization = "Authorization"
+
+	cacheHit    = "HIT"
+	cacheMiss   = "MISS"
+	cacheBypass = "BYPASS"
+)
+
+var responseCacheCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "foundation_gateway_service",
+		Name:      "response_cache_requests_total",
+		Help:      "GET requests to cached routes by result, hit, miss or bypass.",
+	},
+	[]string{"path", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(responseCacheCounter)
+}
+
+// ResponseCacheMiddleware serves GET requests to route from cache, see config.RouteCache for
+// how entries are keyed. settings and global are looked up on every request, so that they can
+// be swapped on configuration reload, global() holds the switches shared by all routes.
+// Without settings requests pass through.
+//
+// Only 200 responses without Set-Cookie are stored. The Cache-Control directives no-store,
+// no-cache and private of a response keep it out of the cache, max-age and s-maxage shorten
+// its TTL. Requests with Cache-Control no-cache skip the lookup, no-store also the storing.
+// Responses to requests with Authorization are only stored and served when their
+// Cache-Control allows a shared cache to, with public, s-maxage or must-revalidate.
+// Response headers named by Vary become part of the key. Responses carry X-Cache with
+// HIT, MISS or BYPASS, hits also carry their Age. Hits answer If-None-Match and
+// If-Modified-Since against the validators of the entry.
+func ResponseCacheMiddleware(route string, settings func() *config.RouteCache, cache bigcache.Cache,
+	global func() *config.ResponseCache) Middleware {
+	var compiled atomic.Pointer[routeCache]
+	policy := func() *routeCache {
+		s := settings()
+		if rc := compiled.Load(); rc != nil && rc.settings == s {
+			return rc
+		}
+		rc := newRouteCache(route, s, cache)
+		compiled.Store(rc)
+		return rc
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			g := global()
+			if r.Method != http.MethodGet || g == nil || !g.Enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rc := policy()
+			if rc.settings == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if g.Debug {
+				responseCacheCounter.WithLabelValues(route, strings.ToLower(cacheBypass)).Inc()
+				w.Header().Set(HTTPHeaderNameXCache, cacheBypass)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			directives := cacheControl(r.Header.Get(HTTPHeaderNameCacheControl))
+			_, noStore := directives["no-store"]
+			_, noCache := directives["no-cache"]
+			noCache = noCache || noStore || strings.EqualFold(r.Header.Get(HTTPHeaderNamePragma), "no-cache")
+
+			authorized := r.Header.Get(HTTPHeaderNameAuthorization) != ""
+			key := rc.key(r)
+			if !noCache {
+				if entry, ok := rc.load(key, r); ok && (!authorized || entry.shared()) {
+					responseCacheCounter.WithLabelValues(route, strings.ToLower(cacheHit)).Inc()
+					entry.write(w, r)
+					return
+				}
+			}
+			responseCacheCounter.WithLabelValues(route, strings.ToLower(cacheMiss)).Inc()
+			w.Header().Set(HTTPHeaderNameXCache, cacheMiss)
+
+			rec := &cacheRecorder{ResponseWriter: w, header: make(http.Header), limit: rc.settings.MaxSize}
+			next.ServeHTTP(rec, r)
+			rec.finish()
+			if !noStore {
+				rc.store(key, r, rec, authorized)
+			}
+		})
+	}
+}
+
+// routeCache is a config.RouteCache prepared for keying requests.
+type routeCache struct {
+	route    string
+	settings *config.RouteCache // identity of the settings it was built from
+	cache    bigcache.Cache
+	headers  []string
+}
+
+// newRouteCache builds the route cache of settings, a nil settings caches nothing.
+func newRouteCache(route string, settings *config.RouteCache, cache bigcache.Cache) *routeCache {
+	rc := &routeCache{route: route, settings: settings, cache: cache}
+	if settings == nil {
+		return rc
+	}
+	for _, h := range settings.Headers {
+		rc.headers = append(rc.headers, http.CanonicalHeaderKey(strings.TrimSpace(h)))
+	}
+	return rc
+}
+
+// key is the cache key of r without the headers named by Vary.
+func (rc *routeCache) key(r *http.Request) string {
+	parts := []string{url.PathEscape(r.URL.Path)}
+	query := r.URL.Query()
+	for _, p := range rc.settings.QueryParams {
+		parts = append(parts, "q:"+url.QueryEscape(p)+"="+escapeValues(query[p]))
+	}
+	for _, h := range rc.headers {
+		parts = append(parts, "h:"+url.QueryEscape(h)+"="+escapeValues(r.Header.Values(h)))
+	}
+	for _, k := range rc.settings.CtxKeys {
+		value, _ := r.Context().Value(k).(string)
+		parts = append(parts, "c:"+url.QueryEscape(k)+"="+url.QueryEscape(value))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "&")))
+	return "respcache|" + rc.route + "|" + hex.EncodeToString(sum[:16])
+}
+
+// variantKey extends key by the values r has for the headers named by Vary.
+// It differs from key even without Vary, key holds the cacheIndex.
+func variantKey(key string, vary []string, r *http.Request) string {
+	parts := make([]string, 0, len(vary))
+	for _, h := range vary {
+		parts = append(parts, url.QueryEscape(h)+"="+escapeValues(r.Header.Values(h)))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "&")))
+	return key + "|" + hex.EncodeToString(sum[:16])
+}
+
+func escapeValues(values []string) string {
+	escaped := make([]string, 0, len(values))
+	for _, v := range values {
+		escaped = append(escaped, url.QueryEscape(v))
+	}
+	return strings.Join(escaped, ",")
+}
+
+// cacheIndex is stored under the key of a request and names the headers its response varies by.
+type cacheIndex struct {
+	Vary []string
+}
+
+type cachedResponse struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Stored  time.Time
+	Expires time.Time
+}
+
+func (rc *routeCache) load(key string, r *http.Request) (*cachedResponse, bool) {
+	var index cacheIndex
+	if !rc.get(key, &index) {
+		return nil, false
+	}
+	var entry cachedResponse
+	if !rc.get(variantKey(key, index.Vary, r), &entry) || time.Now().After(entry.Expires) {
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (rc *routeCache) get(key string, v any) bool {
+	raw, found, err := rc.cache.GetValue(key)
+	if err != nil || !found {
+		return false
+	}
+	return gob.NewDecoder(bytes.NewReader(raw)).Decode(v) == nil
+}
+
+func (rc *routeCache) set(key string, v any) {
+	var buf bytes.Buffer
+	if gob.NewEncoder(&buf).Encode(v) == nil {
+		// Entries larger than BIG_CACHE.MAX_ENTRY_SIZE are refused, the request just stays a miss.
+		_ = rc.cache.SetValue(key, buf.Bytes())
+	}
+}
+
+// store caches the response recorded by rec if it is cacheable. Responses to authorized
+// requests have to allow it explicitly, see sharedDirectives.
+func (rc *routeCache) store(key string, r *http.Request, rec *cacheRecorder, authorized bool) {
+	if rec.Status() != http.StatusOK || rec.overflow || rec.header.Get(HTTPHeaderNameSetCookie) != "" {
+		return
+	}
+	ttl := rc.settings.TTL
+	directives := cacheControl(rec.header.Get(HTTPHeaderNameCacheControl))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[d]; ok {
+			return
+		}
+	}
+	if authorized && !sharedDirectives(directives) {
+		return
+	}
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if seconds, err := strconv.Atoi(directives[d]); err == nil {
+			ttl = min(ttl, time.Duration(seconds)*time.Second)
+			break
+		}
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	var vary []string
+	for _, v := range rec.header.Values(HTTPHeaderNameVary) {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); h == "*" {
+				return
+			} else if h != "" {
+				vary = append(vary, http.CanonicalHeaderKey(h))
+			}
+		}
+	}
+	slices.Sort(vary)
+	vary = slices.Compact(vary)
+
+	now := time.Now()
+	rc.set(key, cacheIndex{Vary: vary})
+	rc.set(variantKey(key, vary, r), cachedResponse{
+		Status:  rec.Status(),
+		Header:  rec.header,
+		Body:    rec.body.Bytes(),
+		Stored:  now,
+		Expires: now.Add(ttl),
+	})
+}
+
+// shared reports whether the entry may be served to requests with Authorization.
+func (e *cachedResponse) shared() bool {
+	return sharedDirectives(cacheControl(e.Header.Get(HTTPHeaderNameCacheControl)))
+}
+
+// sharedDirectives reports whether a response to a request with Authorization may be kept
+// in a shared cache, RFC 9111 section 3.5.
+func sharedDirectives(directives map[string]string) bool {
+	for _, d := range []string{"public", "s-maxage", "must-revalidate"} {
+		if _, ok := directives[d]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// write answers r from the entry, conditional requests matching its validators with 304.
+func (e *cachedResponse) write(w http.ResponseWriter, r *http.Request) {
+	mergeHeaders(w.Header(), e.Header)
+	w.Header().Set(HTTPHeaderNameAge, strconv.Itoa(int(time.Since(e.Stored).Seconds())))
+	w.Header().Set(HTTPHeaderNameXCache, cacheHit)
+	if e.Status == http.StatusOK && notModified(r, e.Header.Get(HTTPHeaderNameETag), e.Header.Get(HTTPHeaderNameLastModified)) {
+		writeNotModified(w)
+		return
+	}
+	w.WriteHeader(e.Status)
+	w.Write(e.Body)
+}
+
+// mergeHeaders sets the headers of src on dst, Vary adds to what is already there.
+func mergeHeaders(dst, src http.Header) {
+	for k, v := range src {
+		if k == HTTPHeaderNameVary {
+			for _, value := range v {
+				dst.Add(k, value)
+			}
+			continue
+		}
+		dst[k] = slices.Clone(v)
+	}
+}
+
+// cacheControl parses a Cache-Control header value into its directives and their arguments.
+func cacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, d := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(d), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+// cacheRecorder passes a response on and records it. The handler gets a header map of its
+// own, so that only headers it set end up in the cache and not those of outer middlewares,
+// like the request id.
+type cacheRecorder struct {
+	http.ResponseWriter
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (r *cacheRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *cacheRecorder) WriteHeader(code int) {
+	if r.status != 0 {
+		return
+	}
+	r.status = code
+	mergeHeaders(r.ResponseWriter.Header(), r.header)
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *cacheRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	if !r.overflow {
+		if r.limit > 0 && r.body.Len()+len(b) > r.limit {
+			r.overflow = true
+			r.body = bytes.Buffer{}
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *cacheRecorder) Flush() {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *cacheRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// finish passes the headers on when the handler wrote nothing at all.
+func (r *cacheRecorder) finish() {
+	if r.status == 0 {
+		mergeHeaders(r.ResponseWriter.Header(), r.header)
+	}
+}
+
+// Status returns the status code sent, 200 when the handler wrote nothing.
+func (r *cacheRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
@@ -0,0 +1,187 @@
+package httpserver
+
+import (
+	"backend/config"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type mapCache struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+func (c *mapCache) GetValue(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.entries[key]
+	return v, ok, nil
+}
+
+func (c *mapCache) SetValue(key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = value
+	return nil
+}
+
+func (c *mapCache) Exists(key string) bool {
+	_, ok, _ := c.GetValue(key)
+	return ok
+}
+
+func TestResponseCacheMiddleware(t *testing.T) {
+	global := &config.ResponseCache{Enabled: true}
+	settings := &config.RouteCache{TTL: time.Minute, QueryParams: []string{"lat"}, CtxKeys: []string{ContextKeySource}}
+	calls := 0
+	var respond func(w http.ResponseWriter, r *http.Request)
+	handler := ResponseCacheMiddleware("/cached", func() *config.RouteCache { return settings }, &mapCache{entries: map[string][]byte{}},
+		func() *config.ResponseCache { return global })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		respond(w, r)
+	}))
+	serve := func(target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), ContextKeySource, "android"))
+		rec := httptest.NewRecorder()
+		// Outer middlewares set headers of their own, they are not cached.
+		rec.Header().Set(HTTPHeaderNameRequestID, target)
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	respond = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HTTPHeaderNameContentType, "application/json")
+		io.WriteString(w, `{"lat":"`+r.URL.Query().Get("lat")+`"}`)
+	}
+	before := testutil.ToFloat64(responseCacheCounter.WithLabelValues("/cached", "hit"))
+
+	rec := serve("/x?lat=1&ignored=a", nil)
+	assert.Equal(t, cacheMiss, rec.Header().Get(HTTPHeaderNameXCache))
+	rec = serve("/x?ignored=b&lat=1", nil)
+	assert.Equal(t, cacheHit, rec.Header().Get(HTTPHeaderNameXCache))
+	assert.Equal(t, "0", rec.Header().Get(HTTPHeaderNameAge))
+	assert.Equal(t, "application/json", rec.Header().Get(HTTPHeaderNameContentType))
+	assert.Equal(t, "/x?ignored=b&lat=1", rec.Header().Get(HTTPHeaderNameRequestID))
+	assert.Equal(t, `{"lat":"1"}`, rec.Body.String())
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, before+1, testutil.ToFloat64(responseCacheCounter.WithLabelValues("/cached", "hit")))
+
+	// Keyed parameters, request Cache-Control and debug mode reach the handler.
+	assert.Equal(t, `{"lat":"2"}`, serve("/x?lat=2", nil).Body.String())
+	assert.Equal(t, cacheMiss, serve("/x?lat=1", map[string]string{HTTPHeaderNameCacheControl: "no-cache"}).Header().Get(HTTPHeaderNameXCache))
+	global = &config.ResponseCache{Enabled: true, Debug: true}
+	assert.Equal(t, cacheBypass, serve("/x?lat=1", nil).Header().Get(HTTPHeaderNameXCache))
+	assert.Equal(t, 4, calls)
+	global = &config.ResponseCache{Enabled: true}
+
+	// Responses vary by the headers they name.
+	respond = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HTTPHeaderNameVary, "Accept-Language")
+		io.WriteString(w, r.Header.Get("Accept-Language"))
+	}
+	serve("/vary", map[string]string{"Accept-Language": "en"})
+	serve("/vary", map[string]string{"Accept-Language": "de"})
+	assert.Equal(t, "en", serve("/vary", map[string]string{"Accept-Language": "en"}).Body.String())
+	rec = serve("/vary", map[string]string{"Accept-Language": "de"})
+	assert.Equal(t, cacheHit, rec.Header().Get(HTTPHeaderNameXCache))
+	assert.Equal(t, "de", rec.Body.String())
+	assert.Equal(t, 6, calls)
+
+	// Hits answer conditional requests from the validators of the entry.
+	respond = func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(HTTPHeaderNameETag, `"v1"`)
+		w.Header().Set(HTTPHeaderNameContentType, "text/plain")
+		io.WriteString(w, "v1")
+	}
+	serve("/etag", nil)
+	rec = serve("/etag", map[string]string{HTTPHeaderNameIfNoneMatch: `"v1"`})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Equal(t, cacheHit, rec.Header().Get(HTTPHeaderNameXCache))
+	assert.Empty(t, rec.Header().Get(HTTPHeaderNameContentType))
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, "v1", serve("/etag", map[string]string{HTTPHeaderNameIfNoneMatch: `"v0"`}).Body.String())
+	assert.Equal(t, 7, calls)
+
+	// Responses to authorized requests are shared only when they allow it.
+	respond = func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get(HTTPHeaderNameAuthorization))
+	}
+	alice := map[string]string{HTTPHeaderNameAuthorization: "Bearer alice"}
+	bob := map[string]string{HTTPHeaderNameAuthorization: "Bearer bob"}
+	serve("/private", alice)
+	rec = serve("/private", bob)
+	assert.Equal(t, cacheMiss, rec.Header().Get(HTTPHeaderNameXCache))
+	assert.Equal(t, "Bearer bob", rec.Body.String())
+	serve("/private", nil)
+	assert.Equal(t, "Bearer alice", serve("/private", alice).Body.String())
+	assert.Equal(t, cacheHit, serve("/private", nil).Header().Get(HTTPHeaderNameXCache))
+
+	respond = func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(HTTPHeaderNameCacheControl, "public, max-age=60")
+		io.WriteString(w, "shared")
+	}
+	serve("/public", alice)
+	rec = serve("/public", bob)
+	assert.Equal(t, cacheHit, rec.Header().Get(HTTPHeaderNameXCache))
+	assert.Equal(t, "shared", rec.Body.String())
+
+	// Uncacheable responses are served fresh every time.
+	for _, respond = range []func(http.ResponseWriter, *http.Request){
+		func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNotFound) },
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set(HTTPHeaderNameCacheControl, "private, max-age=60")
+		},
+		func(w http.ResponseWriter, _ *http.Request) { w.Header().Set(HTTPHeaderNameCacheControl, "max-age=0") },
+		func(w http.ResponseWriter, _ *http.Request) { w.Header().Set(HTTPHeaderNameSetCookie, "session=1") },
+	} {
+		calls = 0
+		serve("/fresh", nil)
+		assert.Equal(t, cacheMiss, serve("/fresh", nil).Header().Get(HTTPHeaderNameXCache))
+		assert.Equal(t, 2, calls)
+	}
+}
+
+func TestResponseCacheMiddleware_Reload(t *testing.T) {
+	global := &config.ResponseCache{Enabled: true}
+	settings := &config.RouteCache{TTL: time.Minute}
+	calls := 0
+	handler := ResponseCacheMiddleware("/reloaded", func() *config.RouteCache { return settings },
+		&mapCache{entries: map[string][]byte{}},
+		func() *config.ResponseCache { return global })(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		io.WriteString(w, "body")
+	}))
+	serve := func(target string) string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Header().Get(HTTPHeaderNameXCache)
+	}
+
+	assert.Equal(t, cacheMiss, serve("/long"))
+	assert.Equal(t, cacheHit, serve("/long"))
+
+	// Entries stored after a reload get the new TTL, earlier ones keep theirs.
+	settings = &config.RouteCache{TTL: 20 * time.Millisecond}
+	assert.Equal(t, cacheMiss, serve("/short"))
+	assert.Equal(t, cacheHit, serve("/short"))
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, cacheMiss, serve("/short"))
+	assert.Equal(t, cacheHit, serve("/long"))
+	assert.Equal(t, 3, calls)
+
+	// A route whose cache settings were removed passes requests through.
+	settings = nil
+	assert.Empty(t, serve("/long"))
+	assert.Equal(t, 4, calls)
+}
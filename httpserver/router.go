@@ -1,12 +1,16 @@
 package httpserver
 
 import (
+	"backend/config"
 	"net/http"
 	"net/http/pprof"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
 )
 
 // Config for a single route.
@@ -16,6 +20,20 @@ type RouteConfig struct {
 	Handler    http.Handler
 	Methods    []string //HTTP Methods
 	Instrument bool     //Should we instrument metrics.
+	// AccessLog enables or disables the access log of the route, nil follows the router settings.
+	AccessLog *bool
+	// Timeout is the context deadline of requests to Handler, 0 means no limit.
+	Timeout time.Duration
+	// TimeoutStatus is the status answered when Timeout is exceeded, 503 or 504. 0 means 504.
+	TimeoutStatus int
+	// ETag enables conditional requests, config.ETagStrong or config.ETagWeak. Empty disables them.
+	// The ETag is computed on what Handler writes, so Handler should not compress.
+	ETag string
+	// CurrentValidators checks If-Match and If-Unmodified-Since of unsafe requests when ETag is set.
+	CurrentValidators ValidatorsFunc
+	// ConcurrencyLimit returns the settings of a limiter of the route, in addition to the one
+	// of the router. nil means the route has none.
+	ConcurrencyLimit func() *config.ConcurrencyLimit
 }
 
 // Router is the interface exposed to add routes to the mux.
@@ -34,13 +52,49 @@ type Router interface {
 type router struct {
 	gmux         *mux.Router
 	instrumentor *PathInstrumentor
+	limiter      *ConcurrencyLimiter
+	traced       bool
+	opts         RouterOptions
 	sync.Mutex
 }
 
-func NewRouter() Router {
+// RouterOptions are the dependencies of the middlewares every route of a router gets.
+// The functions are called per request, so that they can follow configuration reloads.
+type RouterOptions struct {
+	Logger *zap.Logger
+	// ExposePanics reports whether recovered panics are detailed in the response, may be nil.
+	ExposePanics func() bool
+	// AccessLog returns the access log settings, nil disables the access log.
+	AccessLog func() *config.AccessLog
+	// CtxKeys returns the request context keys added to access log entries, may be nil.
+	CtxKeys func() []string
+	// ConcurrencyLimit returns the settings of the limiter shared by all routes, nil disables it.
+	ConcurrencyLimit func() *config.ConcurrencyLimit
+}
+
+// NewRouter returns the router for the public listener.
+// Only routes added through AddRoute are served by it, every route gets a server span,
+// an access log and panic recovery, see AccessLogMiddleware and RecoveryMiddleware.
+func NewRouter(opts RouterOptions) Router {
 	r := &router{
 		gmux:         mux.NewRouter().StrictSlash(true),
 		instrumentor: NewInstrumentor(),
+		traced:       true,
+		opts:         opts,
+	}
+	if opts.ConcurrencyLimit != nil {
+		r.limiter = NewConcurrencyLimiter("server", opts.ConcurrencyLimit)
+	}
+	return r
+}
+
+// NewAdminRouter returns the router for the admin listener.
+// It serves prometheus metrics and pprof, further admin endpoints can be added through AddRoute.
+// Admin routes are not instrumented, panics are recovered like on the public router.
+func NewAdminRouter(logger *zap.Logger) Router {
+	r := &router{
+		gmux: mux.NewRouter().StrictSlash(true),
+		opts: RouterOptions{Logger: logger},
 	}
 	r.debugRoutes()
 	r.promRoute()
@@ -53,8 +107,43 @@ func (r *router) AddRoute(route RouteConfig) {
 	r.Lock()
 	defer r.Unlock()
 	handler := route.Handler
-	if route.Instrument {
-		handler = r.instrumentor.Instrument(route.Path, handler)
+	if route.ETag != "" {
+		handler = ConditionalMiddleware(route.ETag == config.ETagWeak, route.CurrentValidators)(handler)
+	}
+	handler = RecoveryMiddleware(route.Path, r.opts.Logger, r.opts.ExposePanics)(handler)
+	if route.Timeout > 0 {
+		handler = TimeoutMiddleware(route.Path, route.Timeout, route.TimeoutStatus)(handler)
+	}
+	// Limiters adapt to the latency of the requests they admitted, the one of the route is checked first.
+	var limiters []*ConcurrencyLimiter
+	if route.ConcurrencyLimit != nil {
+		limiters = append(limiters, NewConcurrencyLimiter(route.Path, route.ConcurrencyLimit))
+	}
+	if r.limiter != nil {
+		limiters = append(limiters, r.limiter)
+	}
+	observers := make([]LatencyObserver, 0, len(limiters))
+	for _, l := range limiters {
+		observers = append(observers, l)
+	}
+	if route.Instrument && r.instrumentor != nil {
+		handler = r.instrumentor.Instrument(route.Path, handler, observers...)
+	} else {
+		handler = observeLatency(handler, observers...)
+	}
+	for _, l := range limiters {
+		handler = l.Middleware(handler)
+	}
+	if r.opts.AccessLog != nil {
+		ctxKeys := r.opts.CtxKeys
+		if ctxKeys == nil {
+			ctxKeys = func() []string { return nil }
+		}
+		handler = AccessLogMiddleware(route.Path, r.opts.Logger, route.AccessLog, r.opts.AccessLog, ctxKeys)(handler)
+	}
+	if r.traced {
+		// Outermost, so that request metrics see the span and can reference it.
+		handler = TracingMiddleware(route.Path)(handler)
 	}
 	rt := r.gmux.Handle(route.Path, handler)
 	if route.Methods != nil && len(route.Methods) > 0 {
@@ -78,5 +167,7 @@ func (r *router) debugRoutes() {
 }
 
 func (r *router) promRoute() {
-	r.gmux.Handle("/metrics", promhttp.Handler())
+	// OpenMetrics is negotiated by scrapers that support it, it is needed for exemplars.
+	r.gmux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
 }
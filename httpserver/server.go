@@ -3,39 +3,145 @@ package httpserver
 import (
 	"backend/config"
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"strings"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
 type Server struct {
-	config *config.HttpServer
-	srv    *http.Server
-	mux    http.Handler
+	config    *config.HttpServer
+	srv       *http.Server
+	mux       http.Handler
+	readiness *HealthProbe
+	logger    *zap.Logger
+	mu        sync.Mutex
+	stopped   bool
+	// stopReload stops the certificate reloader when TLS is enabled.
+	stopReload context.CancelFunc
 }
 
-func NewServer(config *config.HttpServer, router Router) *Server {
-	fmt.Println(context.Background(), "http server config: ", zap.String("config", config.String()))
+// NewServer returns a server for router, logger reports what happens in the background
+// such as certificate reloads. It may be nil.
+func NewServer(config *config.HttpServer, router Router, logger *zap.Logger) *Server {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	logger.Info("http server config", zap.String("config", config.String()))
 	return &Server{
-		mux:    router.Mux(),
-		config: config}
+		mux:       router.Mux(),
+		config:    config,
+		readiness: NewHealthProbe(),
+		logger:    logger,
+	}
+}
+
+// Readiness returns the probe which starts failing as soon as Shutdown is invoked.
+func (s *Server) Readiness() *HealthProbe {
+	return s.readiness
 }
 
-func (s *Server) Start() {
-	s.config.Port = 8080;
+// Start blocks serving requests until the server is shut down.
+// A nil error is returned when the server was stopped through Shutdown.
+func (s *Server) Start() error {
+	if err := s.config.Validate(); err != nil {
+		return fmt.Errorf("invalid http server config: %w", err)
+	}
 	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", s.config.Port),
-		Handler:      s.mux,
-		ReadTimeout:  s.config.ReadTimeout,
-		WriteTimeout: s.config.WriteTimeout,
-		IdleTimeout:  s.config.IdleTimeout,
+		Addr:              s.config.Addr(),
+		Handler:           s.mux,
+		ReadTimeout:       s.config.ReadTimeout,
+		ReadHeaderTimeout: s.config.ReadHeaderTimeout,
+		WriteTimeout:      s.config.WriteTimeout,
+		IdleTimeout:       s.config.IdleTimeout,
+		MaxHeaderBytes:    s.config.MaxHeaderBytes,
+	}
+	srv.SetKeepAlivesEnabled(!s.config.DisableKeepAlives)
+
+	var reloader *certReloader
+	if s.config.TLS.Enabled {
+		var err error
+		if reloader, err = newCertReloader(s.config.TLS, s.logger); err != nil {
+			return fmt.Errorf("failed to set up tls: %w", err)
+		}
+		srv.TLSConfig = reloader.tlsConfig()
+		srv.Handler = ClientIdentityMiddleware(srv.Handler)
+	}
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
 	}
 	s.srv = srv
+	if reloader != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopReload = cancel
+		go reloader.watch(ctx)
+	}
+	s.mu.Unlock()
+
+	lc := net.ListenConfig{KeepAlive: s.config.TCPKeepAlive}
+	ln, err := lc.Listen(context.Background(), "tcp", srv.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", srv.Addr, err)
+	}
+
+	if reloader != nil {
+		// Certificates come from TLSConfig so that they can be swapped at runtime.
+		err = srv.ServeTLS(ln, "", "")
+	} else {
+		err = srv.Serve(ln)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("http server stopped: %w", err)
+	}
+	return nil
+}
+
+// Shutdown gracefully stops the server.
+//
+// Readiness is flipped to failing first and the server keeps serving for
+// PreStopDelay so that the load balancer can take us out of rotation.
+// After that the listener is closed and in-flight requests are drained for
+// at most ShutdownTimeout. context.DeadlineExceeded is returned when draining
+// did not finish in time.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.readiness.SetReady(false)
+
+	if s.config.PreStopDelay > 0 {
+		select {
+		case <-time.After(s.config.PreStopDelay):
+		case <-ctx.Done():
+			// Out of time already, the server is still stopped and closed below.
+		}
+	}
+
+	if s.config.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.ShutdownTimeout)
+		defer cancel()
+	}
+
+	s.mu.Lock()
+	s.stopped = true
+	srv := s.srv
+	if s.stopReload != nil {
+		s.stopReload()
+	}
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
 
-	err := srv.ListenAndServe()
-	if err != nil && !strings.Contains(err.Error(), "http: Server closed") {
-		fmt.Println(context.Background(), "failed to start server %v", zap.Error(err))
+	if err := srv.Shutdown(ctx); err != nil {
+		// Whatever is still in flight gets cut off at this point.
+		srv.Close()
+		return err
 	}
+	return nil
 }
@@ -0,0 +1,158 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const ErrorCodeTimeout = "timeout"
+
+var timeoutsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "foundation_gateway_service",
+		Name:      "request_timeouts_total",
+		Help:      "Requests which exceeded the timeout of their route.",
+	},
+	[]string{"path"},
+)
+
+func init() {
+	prometheus.MustRegister(timeoutsCounter)
+}
+
+// TimeoutMiddleware gives every request of route a context deadline of timeout. When the
+// handler has not finished by then the client gets a JSON error with status, 503 or 504
+// (0 means 504), and everything the handler writes afterwards is discarded with
+// http.ErrHandlerTimeout. Handlers should pass the context on, see RemainingBudget.
+// Headers the handler set are dropped with its response, middlewares which add headers
+// to every response have to run before TimeoutMiddleware.
+//
+// Like http.TimeoutHandler the response is buffered until the handler returns,
+// so flushing is not supported on routes with a timeout.
+func TimeoutMiddleware(route string, timeout time.Duration, status int) Middleware {
+	if status == 0 {
+		status = http.StatusGatewayTimeout
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						if err, ok := p.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+							panicked <- p
+							return
+						}
+						panicked <- &handlerPanic{value: p, stack: debug.Stack()}
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				// Re-panic on the serving goroutine, a panic on the handler goroutine would crash the
+				// process. The stack of the handler goes along, see RecoveryMiddleware.
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				dst := w.Header()
+				for k, v := range tw.header {
+					dst[k] = v
+				}
+				if tw.code == 0 {
+					tw.code = http.StatusOK
+				}
+				w.WriteHeader(tw.code)
+				w.Write(tw.body.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.err = http.ErrHandlerTimeout
+				if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					// The client went away, there is no one to answer.
+					return
+				}
+				timeoutsCounter.WithLabelValues(route).Inc()
+				WriteError(w, r, status, ErrorBody{
+					Code:    ErrorCodeTimeout,
+					Message: fmt.Sprintf("request did not complete within %v", timeout),
+				})
+			}
+		})
+	}
+}
+
+// RemainingBudget returns the time left until the deadline of ctx, so that handlers can
+// bound downstream calls by it. ok is false when ctx has no deadline.
+func RemainingBudget(ctx context.Context) (remaining time.Duration, ok bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	if remaining = time.Until(deadline); remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
+// handlerPanic is a panic raised again on another goroutine, with the stack of the
+// goroutine it was raised on first.
+type handlerPanic struct {
+	value any
+	stack []byte
+}
+
+func (p *handlerPanic) String() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
+// timeoutWriter buffers the response of a handler running under TimeoutMiddleware.
+type timeoutWriter struct {
+	mu     sync.Mutex
+	header http.Header
+	body   bytes.Buffer
+	code   int
+	err    error
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.err != nil {
+		return 0, tw.err
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.body.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.err != nil || tw.code != 0 {
+		return
+	}
+	tw.code = code
+}
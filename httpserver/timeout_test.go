@@ -0,0 +1,80 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	lateWrite := make(chan error, 1)
+	answered := make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		<-r.Context().Done()
+		<-answered
+		_, err := w.Write([]byte("late"))
+		lateWrite <- err
+	})
+	before := testutil.ToFloat64(timeoutsCounter.WithLabelValues("/slow"))
+
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+	req.Header.Set(HTTPHeaderNameRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	ChainMiddleware(slow, RequestIdMiddleware, TimeoutMiddleware("/slow", 10*time.Millisecond, 0)).ServeHTTP(rec, req)
+	close(answered)
+
+	require.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Equal(t, "req-1", rec.Header().Get(HTTPHeaderNameRequestID))
+	assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, ErrorBody{Code: ErrorCodeTimeout, Message: "request did not complete within 10ms", RequestID: "req-1"}, resp.Error)
+	assert.Equal(t, before+1, testutil.ToFloat64(timeoutsCounter.WithLabelValues("/slow")))
+	assert.ErrorIs(t, <-lateWrite, http.ErrHandlerTimeout)
+
+	rec = httptest.NewRecorder()
+	TimeoutMiddleware("/slow", 10*time.Millisecond, http.StatusServiceUnavailable)(slow).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var budget time.Duration
+	fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget, _ = RemainingBudget(r.Context())
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("ok"))
+	})
+	rec = httptest.NewRecorder()
+	TimeoutMiddleware("/fast", time.Second, 0)(fast).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "text/plain", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "ok", rec.Body.String())
+	assert.True(t, budget > 0 && budget <= time.Second, budget)
+}
+
+func TestTimeoutMiddlewarePanic(t *testing.T) {
+	h := TimeoutMiddleware("/boom", time.Second, 0)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/boom", nil))
+	})
+}
+
+func TestRemainingBudget(t *testing.T) {
+	_, ok := RemainingBudget(context.Background())
+	assert.False(t, ok)
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	remaining, ok := RemainingBudget(ctx)
+	assert.True(t, ok)
+	assert.Zero(t, remaining)
+}
@@ -0,0 +1,189 @@
+package httpserver
+
+import (
+	"backend/config"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultCertReloadInterval = 30 * time.Second
+
+// tlsMaterial is everything read from disk for one generation of certificates.
+type tlsMaterial struct {
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+// certReloader serves the current certificate and client CA bundle and
+// swaps them when the files change on disk, without restarting the listener.
+type certReloader struct {
+	cfg        config.TLS
+	minVersion uint16
+	ciphers    []uint16
+	clientAuth tls.ClientAuthType
+	logger     *zap.Logger
+	current    atomic.Pointer[tlsMaterial]
+}
+
+func newCertReloader(cfg config.TLS, logger *zap.Logger) (*certReloader, error) {
+	r := &certReloader{cfg: cfg, logger: logger}
+	var err error
+	if r.minVersion, err = cfg.ParsedMinVersion(); err != nil {
+		return nil, err
+	}
+	if r.ciphers, err = cfg.ParsedCipherSuites(); err != nil {
+		return nil, err
+	}
+	if r.clientAuth, err = cfg.ParsedClientAuth(); err != nil {
+		return nil, err
+	}
+	m, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.current.Store(m)
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+func (r *certReloader) load() (*tlsMaterial, error) {
+	m := &tlsMaterial{modTimes: make(map[string]time.Time)}
+	for _, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		m.modTimes[f] = fi.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading key pair: %w", err)
+	}
+	m.cert = &cert
+
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CA bundle: %w", err)
+		}
+		m.clientCAs = x509.NewCertPool()
+		if !m.clientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA bundle %s", r.cfg.ClientCAFile)
+		}
+	}
+	return m, nil
+}
+
+// changed reports whether any of the files has a different modification time than the loaded ones.
+func (r *certReloader) changed() bool {
+	m := r.current.Load()
+	for _, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err != nil {
+			// Files are usually swapped via symlinks, it might be mid-update.
+			return false
+		}
+		if !fi.ModTime().Equal(m.modTimes[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch polls the files until ctx is done. A failed reload keeps the previous certificates.
+func (r *certReloader) watch(ctx context.Context) {
+	interval := r.cfg.ReloadInterval
+	if interval == 0 {
+		interval = defaultCertReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !r.changed() {
+			continue
+		}
+		m, err := r.load()
+		if err != nil {
+			r.logger.Error("failed to reload tls certificates, keeping the previous ones", zap.Error(err))
+			continue
+		}
+		r.current.Store(m)
+		r.logger.Info("reloaded tls certificates", zap.String("certFile", r.cfg.CertFile))
+	}
+}
+
+// tlsConfig returns a config which picks up the latest certificates on every handshake.
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: r.minVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			m := r.current.Load()
+			return &tls.Config{
+				Certificates: []tls.Certificate{*m.cert},
+				ClientCAs:    m.clientCAs,
+				ClientAuth:   r.clientAuth,
+				MinVersion:   r.minVersion,
+				CipherSuites: r.ciphers,
+				NextProtos:   []string{"h2", "http/1.1"},
+			}, nil
+		},
+	}
+}
+
+// ClientIdentityMiddleware attaches the identity of a verified client certificate
+// to the request context under ContextKeyClientID.
+// The first URI SAN (e.g. a SPIFFE ID) is preferred, then the subject common name, then the first DNS SAN.
+func ClientIdentityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := clientIdentity(r.TLS); id != "" {
+			r = r.WithContext(AttachToCtx(r.Context(), ContextKeyClientID, id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func clientIdentity(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	leaf := state.VerifiedChains[0][0]
+	switch {
+	case len(leaf.URIs) > 0:
+		return leaf.URIs[0].String()
+	case leaf.Subject.CommonName != "":
+		return leaf.Subject.CommonName
+	case len(leaf.DNSNames) > 0:
+		return leaf.DNSNames[0]
+	}
+	return ""
+}
+
+func GetClientID(ctx context.Context) string {
+	if id, ok := ctx.Value(ContextKeyClientID).(string); ok {
+		return id
+	}
+	return ""
+}
@@ -0,0 +1,221 @@
+package httpserver
+
+import (
+	"backend/config"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue signs tmpl and returns the certificate and key in PEM.
+func (ca *testCA) issue(t *testing.T, tmpl *x509.Certificate) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func (ca *testCA) serverCert(t *testing.T, serial int64) (certPEM, keyPEM []byte) {
+	return ca.issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+}
+
+func (ca *testCA) clientCert(t *testing.T, tmpl *x509.Certificate) tls.Certificate {
+	tmpl.SerialNumber = big.NewInt(100)
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	cert, err := tls.X509KeyPair(ca.issue(t, tmpl))
+	require.NoError(t, err)
+	return cert
+}
+
+// writeFiles writes the files and moves their modification time forward, so that
+// a rewrite within the resolution of the file system still counts as a change.
+func writeFiles(t *testing.T, modTime time.Time, files map[string][]byte) {
+	t.Helper()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(name, content, 0o600))
+		require.NoError(t, os.Chtimes(name, modTime, modTime))
+	}
+}
+
+func servedSerial(t *testing.T, r *certReloader) int64 {
+	t.Helper()
+	cfg, err := r.tlsConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertReloader_Reload(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	cfg := config.TLS{
+		Enabled:        true,
+		CertFile:       filepath.Join(dir, "tls.crt"),
+		KeyFile:        filepath.Join(dir, "tls.key"),
+		ReloadInterval: 10 * time.Millisecond,
+	}
+	certPEM, keyPEM := ca.serverCert(t, 1)
+	start := time.Now().Add(-time.Minute)
+	writeFiles(t, start, map[string][]byte{cfg.CertFile: certPEM, cfg.KeyFile: keyPEM})
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	r, err := newCertReloader(cfg, zap.New(core))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), servedSerial(t, r))
+	assert.False(t, r.changed())
+
+	// A broken rewrite keeps the previous certificate.
+	writeFiles(t, start.Add(time.Second), map[string][]byte{cfg.CertFile: []byte("garbage")})
+	assert.True(t, r.changed())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.watch(ctx)
+	require.Eventually(t, func() bool {
+		return logs.FilterMessage("failed to reload tls certificates, keeping the previous ones").Len() > 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int64(1), servedSerial(t, r))
+
+	certPEM, keyPEM = ca.serverCert(t, 2)
+	writeFiles(t, start.Add(2*time.Second), map[string][]byte{cfg.CertFile: certPEM, cfg.KeyFile: keyPEM})
+	require.Eventually(t, func() bool { return servedSerial(t, r) == 2 }, time.Second, 5*time.Millisecond)
+	assert.NotZero(t, logs.FilterMessage("reloaded tls certificates").Len())
+}
+
+func TestClientIdentityMiddleware_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	cfg := config.TLS{
+		Enabled:      true,
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+		ClientAuth:   "verify_if_given",
+	}
+	certPEM, keyPEM := ca.serverCert(t, 1)
+	writeFiles(t, time.Now(), map[string][]byte{cfg.CertFile: certPEM, cfg.KeyFile: keyPEM, cfg.ClientCAFile: ca.pem})
+	r, err := newCertReloader(cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(ClientIdentityMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, GetClientID(r.Context()))
+	})))
+	srv.TLS = r.tlsConfig()
+	// The rejected handshake is logged by the server.
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(clientCerts ...tls.Certificate) (string, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: clientCerts,
+		}}}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	id, err := get(ca.clientCert(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "orders"},
+		URIs:    []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/orders"}},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "spiffe://example.org/orders", id)
+
+	id, err = get()
+	require.NoError(t, err)
+	assert.Empty(t, id)
+
+	// Certificates of other CAs fail verification.
+	_, err = get(newTestCA(t).clientCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "intruder"}}))
+	assert.Error(t, err)
+}
+
+func TestClientIdentity(t *testing.T) {
+	uri := &url.URL{Scheme: "spiffe", Host: "example.org", Path: "/orders"}
+	tests := []struct {
+		name string
+		leaf *x509.Certificate
+		want string
+	}{
+		{"uri san first", &x509.Certificate{URIs: []*url.URL{uri}, Subject: pkix.Name{CommonName: "orders"}, DNSNames: []string{"orders.internal"}}, "spiffe://example.org/orders"},
+		{"then common name", &x509.Certificate{Subject: pkix.Name{CommonName: "orders"}, DNSNames: []string{"orders.internal"}}, "orders"},
+		{"then dns san", &x509.Certificate{DNSNames: []string{"orders.internal", "orders"}}, "orders.internal"},
+		{"nothing", &x509.Certificate{}, ""},
+	}
+	for _, tt := range tests {
+		state := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.leaf}}}
+		assert.Equal(t, tt.want, clientIdentity(state), tt.name)
+	}
+	// Unverified certificates carry no identity.
+	assert.Empty(t, clientIdentity(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{tests[0].leaf}}))
+	assert.Empty(t, clientIdentity(nil))
+}
@@ -0,0 +1,66 @@
+package httpserver
+
+import (
+	"backend/tracing"
+	"context"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// TracingMiddleware continues the trace of the traceparent and tracestate headers, or starts
+// a new one, and wraps the request in a server span named after the route template, e.g.
+// "GET /api/v1/location_based_features", so that spans of one route group together.
+func TracingMiddleware(route string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := tracing.Extract(r.Context(), r.Header)
+			ctx, span := tracing.StartServerSpan(ctx, r.Method+" "+route,
+				semconv.HTTPRoute(route),
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.UserAgentOriginal(r.UserAgent()),
+			)
+			defer span.End()
+
+			rec := newStatusRecorder(w)
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			status := rec.Status()
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		})
+	}
+}
+
+// tagSpanWithReqID records the request id on the current span, so that traces can be
+// found from the id a client reports.
+func tagSpanWithReqID(ctx context.Context, reqID string) {
+	tracing.SpanFromContext(ctx).SetAttributes(attribute.String("request.id", reqID))
+}
+
+// exemplarLabels links request metrics to the trace and the request id of the request.
+// Only sampled traces are referenced, the others are not exported and cannot be looked up.
+// Request ids too long for the exemplar size limit are left out.
+func exemplarLabels(ctx context.Context) prometheus.Labels {
+	if !tracing.Sampled(ctx) {
+		return nil
+	}
+	labels := prometheus.Labels{"trace_id": tracing.TraceID(ctx), "span_id": tracing.SpanID(ctx)}
+	if reqID := GetReqID(handlerContext(ctx)); reqID != "" {
+		runes := utf8.RuneCountInString("request_id" + reqID)
+		for name, value := range labels {
+			runes += utf8.RuneCountInString(name + value)
+		}
+		if runes <= prometheus.ExemplarMaxRunes {
+			labels["request_id"] = reqID
+		}
+	}
+	return labels
+}
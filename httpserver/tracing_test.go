@@ -0,0 +1,71 @@
+package httpserver
+
+import (
+	"backend/tracing"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+
+	var traceID string
+	handler := TracingMiddleware("/users/{id}")(RequestIdMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID = tracing.TraceID(r.Context())
+		w.WriteHeader(http.StatusBadGateway)
+	})))
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(HTTPHeaderNameRequestID, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Len(t, spans.Ended(), 1)
+	span := spans.Ended()[0]
+	assert.Equal(t, "GET /users/{id}", span.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Contains(t, span.Attributes(), attribute.String("http.route", "/users/{id}"))
+	assert.Contains(t, span.Attributes(), attribute.String("request.id", "req-1"))
+	assert.Contains(t, span.Attributes(), attribute.Int("http.response.status_code", http.StatusBadGateway))
+	assert.Equal(t, "Error", span.Status().Code.String())
+}
+
+func TestExemplarLabels(t *testing.T) {
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+	labels := exemplarLabels(ctx)
+	assert.Equal(t, prometheus.Labels{"trace_id": tracing.TraceID(ctx), "span_id": tracing.SpanID(ctx)}, labels)
+
+	// The request id is attached by route middlewares, inside the instrumented handler.
+	labelsOf := func(reqID string) prometheus.Labels {
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		req, captured := withCapturedContext(req)
+		req.Header.Set(HTTPHeaderNameRequestID, reqID)
+		RequestIdMiddleware(captureContext(http.NotFoundHandler())).ServeHTTP(httptest.NewRecorder(), req)
+		require.NotNil(t, captured.Pointer.Load())
+		return exemplarLabels(req.Context())
+	}
+	labels = labelsOf("3f2b8c1e-9a4d-4e57-b1c0-7d6e5f4a3b2c")
+	assert.Equal(t, "3f2b8c1e-9a4d-4e57-b1c0-7d6e5f4a3b2c", labels["request_id"])
+	assert.Equal(t, tracing.TraceID(ctx), labels["trace_id"])
+	assert.LessOrEqual(t, len("request_id"+labels["request_id"]+"trace_id"+labels["trace_id"]+"span_id"+labels["span_id"]), prometheus.ExemplarMaxRunes)
+
+	// Ids beyond the exemplar size limit are left out rather than failing the request.
+	labels = labelsOf(strings.Repeat("a", 64))
+	assert.NotContains(t, labels, "request_id")
+	assert.Contains(t, labels, "trace_id")
+
+	assert.Nil(t, exemplarLabels(context.Background()))
+}
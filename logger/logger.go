@@ -2,16 +2,55 @@ package logger
 
 import (
 	"backend/config"
+	"backend/httpserver"
+	"backend/tracing"
+	"context"
+	"strings"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
+// level is shared by every logger built here so that verbosity can be changed at runtime.
+var level = zap.NewAtomicLevel()
+
 func ConfigureLogging(cfg *config.Log) (*zap.Logger, error) {
-	var logger *zap.Logger
-	logger, err := zap.NewProduction()
+	if err := SetLevel(cfg); err != nil {
+		return nil, err
+	}
+	zapCfg := zap.NewProductionConfig()
+	zapCfg.Level = level
+	logger, err := zapCfg.Build()
 	if err != nil {
 		return nil, err
 	}
-	logger.Info("Logger Initialized!")
+	logger.Info("Logger Initialized!", zap.Stringer("level", level))
 	return logger, nil
 }
+
+// SetLevel changes the level of all loggers returned by ConfigureLogging.
+// An empty level means info.
+func SetLevel(cfg *config.Log) error {
+	l := zapcore.InfoLevel
+	if cfg.Level != "" {
+		var err error
+		if l, err = zapcore.ParseLevel(strings.ToLower(cfg.Level)); err != nil {
+			return err
+		}
+	}
+	level.SetLevel(l)
+	return nil
+}
+
+// WithContext returns l with the request id and the trace and span ids of ctx as fields,
+// so that the entries of one request can be found together and next to its trace.
+func WithContext(ctx context.Context, l *zap.Logger) *zap.Logger {
+	fields := make([]zap.Field, 0, 3)
+	if reqID := httpserver.GetReqID(ctx); reqID != "" {
+		fields = append(fields, zap.String(httpserver.ContextKeyReqID, reqID))
+	}
+	if traceID := tracing.TraceID(ctx); traceID != "" {
+		fields = append(fields, zap.String("traceId", traceID), zap.String("spanId", tracing.SpanID(ctx)))
+	}
+	return l.With(fields...)
+}
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"context"
+
 	"github.com/allegro/bigcache/v3"
 	"github.com/prometheus/client_golang/prometheus"
 	"time"
@@ -88,10 +90,17 @@ func InitBigCacheMetrics() BigCacheMetrics {
 	}
 }
 
-func CollectStatistics(cache *bigcache.BigCache, metrics BigCacheMetrics) {
+// CollectStatistics publishes cache stats every minute until ctx is cancelled.
+func CollectStatistics(ctx context.Context, cache *bigcache.BigCache, metrics BigCacheMetrics) {
 	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 
 		cacheStats := cache.Stats()
 